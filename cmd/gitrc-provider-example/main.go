@@ -0,0 +1,38 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Command gitrc-provider-example is the reference plugin of the gitrc plugin protocol.
+// It provides the type example, which manages bare repositories in the directory host_base_url like the local remote,
+// so it can be tried without any server. Install it on your PATH and configure a remote of type example:
+//
+//	go install github.com/wpueschel/gitrc/cmd/gitrc-provider-example
+//	gitrc plugin check --write example
+//
+// Plugins for other providers implement remote.Remote and serve it the same way.
+package main
+
+import (
+	"github.com/wpueschel/gitrc/remote"
+)
+
+func main() {
+	remote.ServePlugin(func(p remote.Provider) (remote.Remote, error) {
+		if p.HostBaseURL == "" {
+			p.HostBaseURL = "."
+		}
+		return remote.NewLocalRemote(p)
+	})
+}
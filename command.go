@@ -0,0 +1,336 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wpueschel/gitrc/remote"
+)
+
+// errUsage is returned when a command was called with wrong arguments.
+// The usage of the command has already been printed in this case.
+var errUsage = errors.New("wrong usage")
+
+// options contains the global command line options
+type options struct {
+	ctx        context.Context
+	timeout    time.Duration
+	configFile string
+	provider   string
+	output     string
+	template   string
+	columns    string
+}
+
+// addFlags adds the global options to a flag set
+func (o *options) addFlags(fs *flag.FlagSet) {
+	// The current values are used as defaults, so values given to a parent command are kept
+	fs.StringVar(&o.configFile, "config", o.configFile, "Config file")
+	fs.StringVar(&o.configFile, "c", o.configFile, "Config file (shorthand)")
+	fs.StringVar(&o.provider, "provider", o.provider, "Remote to use, as named in the config file")
+	fs.StringVar(&o.provider, "p", o.provider, "Remote to use (shorthand)")
+	fs.StringVar(&o.output, "output", o.output, fmt.Sprintf("Output format, one of: %s", strings.Join(outputFormats, ", ")))
+	fs.StringVar(&o.output, "o", o.output, "Output format (shorthand)")
+	fs.StringVar(&o.template, "template", o.template, "Go template for the template output format, e.g. '{{.Name}} {{.SSHURL}}'")
+	fs.StringVar(&o.columns, "columns", o.columns, "Comma separated list of columns for table and csv output")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "Timeout for the whole command, e.g. 30s or 5m (default: no timeout)")
+}
+
+// context returns the context for a command, which is cancelled when the timeout expires
+func (o *options) context() (context.Context, context.CancelFunc) {
+	if o.timeout > 0 {
+		return context.WithTimeout(o.ctx, o.timeout)
+	}
+	return context.WithCancel(o.ctx)
+}
+
+// command is a node in the command tree of gitrc.
+// A command either has subcommands or a run function.
+type command struct {
+	name     string
+	usage    string
+	short    string
+	long     string
+	commands []*command
+
+	// setFlags adds command specific flags to the commands flag set
+	setFlags func(fs *flag.FlagSet)
+	// run executes the command with the remaining positional arguments
+	run func(ctx context.Context, args []string) error
+
+	parent *command
+	opts   *options
+}
+
+// path returns the full command path, e.g. "gitrc repo create"
+func (c *command) path() string {
+	if c.parent == nil {
+		return c.name
+	}
+	return c.parent.path() + " " + c.name
+}
+
+// find returns the subcommand with the given name or nil
+func (c *command) find(name string) *command {
+	for _, sub := range c.commands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// add adds subcommands to a command
+func (c *command) add(cmds ...*command) *command {
+	for _, sub := range cmds {
+		sub.parent = c
+		sub.setOptions(c.opts)
+		c.commands = append(c.commands, sub)
+	}
+	return c
+}
+
+// setOptions sets the global options of a command and all of its subcommands
+func (c *command) setOptions(o *options) {
+	c.opts = o
+	for _, sub := range c.commands {
+		sub.setOptions(o)
+	}
+}
+
+// flagSet creates the flag set of a command containing the global and the command specific flags
+func (c *command) flagSet(w io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.path(), flag.ContinueOnError)
+	fs.SetOutput(w)
+	c.opts.addFlags(fs)
+	if c.setFlags != nil {
+		c.setFlags(fs)
+	}
+	fs.Usage = func() { c.printUsage(w) }
+	return fs
+}
+
+// printUsage prints the help text of a command
+func (c *command) printUsage(w io.Writer) {
+
+	usage := c.usage
+	if usage == "" {
+		usage = c.name
+		if len(c.commands) > 0 {
+			usage += " <command>"
+		}
+	}
+	if c.parent != nil {
+		usage = c.parent.path() + " " + usage
+	}
+	fmt.Fprintf(w, "Usage: %s\n", usage)
+
+	if c.long != "" {
+		fmt.Fprintf(w, "\n%s\n", c.long)
+	} else if c.short != "" {
+		fmt.Fprintf(w, "\n%s\n", c.short)
+	}
+
+	if len(c.commands) > 0 {
+		fmt.Fprintf(w, "\nCommands:\n")
+		for _, sub := range c.commands {
+			fmt.Fprintf(w, "  %-10s %s\n", sub.name, sub.short)
+		}
+	}
+
+	// Command specific and global flags are printed separately
+	if c.setFlags != nil {
+		fs := flag.NewFlagSet(c.path(), flag.ContinueOnError)
+		fs.SetOutput(w)
+		c.setFlags(fs)
+		fmt.Fprintf(w, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	global := flag.NewFlagSet(c.path(), flag.ContinueOnError)
+	global.SetOutput(w)
+	c.opts.addFlags(global)
+	fmt.Fprintf(w, "\nGlobal Flags:\n")
+	global.PrintDefaults()
+
+	if len(c.commands) > 0 {
+		fmt.Fprintf(w, "\nUse \"%s <command> -h\" for more information about a command.\n", c.path())
+	}
+}
+
+// execute parses args and runs the command or dispatches to a subcommand
+func (c *command) execute(args []string) error {
+
+	fs := c.flagSet(os.Stderr)
+
+	// Commands with subcommands only parse the flags up to the subcommand name
+	if len(c.commands) > 0 {
+		err := fs.Parse(args)
+		if err == flag.ErrHelp {
+			return nil
+		}
+		if err != nil {
+			return errUsage
+		}
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return errUsage
+		}
+		sub := c.find(fs.Arg(0))
+		if sub == nil {
+			fmt.Fprintf(os.Stderr, "Unknown command \"%s\" for \"%s\"\n\n", fs.Arg(0), c.path())
+			fs.Usage()
+			return errUsage
+		}
+		return sub.execute(fs.Args()[1:])
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err == flag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return errUsage
+	}
+
+	ctx, cancel := c.opts.context()
+	defer cancel()
+
+	return c.run(ctx, positional)
+}
+
+// parseInterspersed parses flags which may be placed before, between or after the positional arguments.
+// Arguments after "--" are never treated as flags.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+
+	var positional, rest []string
+
+	for i, a := range args {
+		if a == "--" {
+			rest = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	return append(positional, rest...), nil
+}
+
+// exactArgs checks the number of positional arguments of a command
+func (c *command) exactArgs(args []string, min, max int) error {
+	if len(args) < min || len(args) > max {
+		fmt.Fprintf(os.Stderr, "Wrong number of arguments for \"%s\"\n\n", c.path())
+		c.flagSet(os.Stderr).Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// newRootCommand creates the command tree of gitrc.
+// All commands are cancelled, when ctx is done.
+func newRootCommand(ctx context.Context) *command {
+
+	root := &command{
+		name:  "gitrc",
+		usage: "gitrc [flags] <command>",
+		short: "gitrc - Git Remote Control",
+	}
+	root.setOptions(&options{ctx: ctx, configFile: remote.DefaultConfigFile(), output: outputTable})
+
+	root.add(
+		newRepoCommand(),
+		newConfigCommand(),
+		newProvidersCommand(),
+		newPluginCommand(),
+		newVersionCommand(),
+		newHelpCommand(root),
+	)
+
+	return root
+}
+
+// newHelpCommand creates the help command, which prints the usage of any other command
+func newHelpCommand(root *command) *command {
+
+	c := &command{
+		name:  "help",
+		usage: "help [command...]",
+		short: "Show help for a command",
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+		target := root
+		for _, name := range args {
+			sub := target.find(name)
+			if sub == nil {
+				return fmt.Errorf("Unknown command: %s", strings.Join(args, " "))
+			}
+			target = sub
+		}
+		target.flagSet(os.Stdout).Usage()
+		return nil
+	}
+
+	return c
+}
+
+// versionInfo is the result of the version command
+type versionInfo struct {
+	Version string `json:"version" yaml:"version"`
+}
+
+// newVersionCommand creates the version command
+func newVersionCommand() *command {
+
+	c := &command{
+		name:  "version",
+		short: "Print the version of gitrc",
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+		if err := c.exactArgs(args, 0, 0); err != nil {
+			return err
+		}
+		p, err := newPrinter(os.Stdout, c.opts)
+		if err != nil {
+			return err
+		}
+		return p.print(versionInfo{Version: version})
+	}
+
+	return c
+}
@@ -0,0 +1,113 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/wpueschel/gitrc/remote"
+)
+
+// providerInfo is the result of the config show command
+type providerInfo struct {
+	Name            string `json:"name" yaml:"name"`
+	remote.Provider `yaml:",inline"`
+}
+
+// newConfigCommand creates the config command and its subcommands
+func newConfigCommand() *command {
+
+	c := &command{
+		name:  "config",
+		short: "Inspect the configuration",
+	}
+
+	return c.add(
+		newConfigPathCommand(),
+		newConfigShowCommand(),
+	)
+}
+
+// newConfigPathCommand creates the config path command
+func newConfigPathCommand() *command {
+
+	c := &command{
+		name:  "path",
+		short: "Print the location of the config file",
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+		if err := c.exactArgs(args, 0, 0); err != nil {
+			return err
+		}
+		fmt.Println(c.opts.configFile)
+		return nil
+	}
+
+	return c
+}
+
+// newConfigShowCommand creates the config show command
+func newConfigShowCommand() *command {
+
+	c := &command{
+		name:  "show",
+		short: "Print the configuration with masked credentials",
+		long: `Prints the configuration of all remotes or, if --provider is given, of a single remote.
+Tokens and passwords are masked.`,
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 0, 0); err != nil {
+			return err
+		}
+
+		config, err := remote.NewConfig(c.opts.configFile)
+		if err != nil {
+			return fmt.Errorf("Could not read config: %s", err)
+		}
+
+		p, err := newPrinter(os.Stdout, c.opts)
+		if err != nil {
+			return err
+		}
+
+		var show []providerInfo
+		for _, name := range config.Names() {
+			if c.opts.provider != "" && c.opts.provider != name {
+				continue
+			}
+			typ, err := config.Type(name)
+			if err != nil {
+				return err
+			}
+			info := providerInfo{Name: name, Provider: config.Provider[name].Masked()}
+			info.Type = typ
+			show = append(show, info)
+		}
+		if c.opts.provider != "" && len(show) == 0 {
+			return fmt.Errorf("Remote %s is not configured in %s", c.opts.provider, c.opts.configFile)
+		}
+
+		return p.print(show, "name", "type", "user", "host_base_url", "clone_protocol")
+	}
+
+	return c
+}
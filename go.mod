@@ -5,7 +5,11 @@ go 1.14
 require (
 	code.gitea.io/sdk/gitea v0.11.0
 	github.com/google/go-github v17.0.0+incompatible
+	github.com/hashicorp/go-version v1.2.0
 	github.com/xanzy/go-gitlab v0.28.0
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	gopkg.in/src-d/go-billy.v4 v4.3.2
 	gopkg.in/src-d/go-git.v4 v4.13.1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,152 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/wpueschel/gitrc/remote"
+)
+
+// legacyFlags contains the command line flags of the deprecated "gitrc [options] [provider]" form
+type legacyFlags struct {
+	configFile string
+	repoName   string
+	newrepo    bool
+	list       bool
+	listLong   bool
+	private    bool
+	del        bool
+}
+
+// newLegacyFlagSet creates a flag set for the deprecated command line form
+func newLegacyFlagSet(l *legacyFlags) *flag.FlagSet {
+
+	fs := flag.NewFlagSet("gitrc", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	fs.StringVar(&l.configFile, "c", remote.DefaultConfigFile(), "Config file")
+	fs.StringVar(&l.repoName, "n", "", "Repository name")
+	fs.BoolVar(&l.list, "l", false, "List remote repository names and last commit timestamp")
+	fs.BoolVar(&l.listLong, "L", false, "List remote repository names, cloning urls and last commit timestamp")
+	fs.BoolVar(&l.private, "P", false, "Create a private repository")
+	fs.BoolVar(&l.del, "D", false, "Delete a remote repository, has to be used with -n")
+	fs.BoolVar(&l.newrepo, "N", false, "Create a local and remote repo based on the current directory name")
+
+	return fs
+}
+
+// isLegacy checks if args use the deprecated "gitrc [options] [provider]" form,
+// which is the case if only the old flags and a single provider name, which is no command, are given.
+// A request for help is answered by the new form.
+func isLegacy(root *command, args []string) bool {
+
+	fs := newLegacyFlagSet(new(legacyFlags))
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 1 {
+		return false
+	}
+
+	return root.find(fs.Arg(0)) == nil
+}
+
+// runLegacy runs gitrc with the deprecated "gitrc [options] [provider]" form
+func runLegacy(root *command, args []string) error {
+
+	log.Printf("Deprecated: \"gitrc [options] [provider]\" will be removed in a future release, use \"gitrc --provider <remote> repo <command>\" instead")
+
+	l := new(legacyFlags)
+	fs := newLegacyFlagSet(l)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	o := &options{ctx: root.opts.ctx, configFile: l.configFile, provider: fs.Arg(0), output: outputTable}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	p, err := newPrinter(os.Stdout, o)
+	if err != nil {
+		return err
+	}
+
+	r, provider, err := newRemote(o)
+	if err != nil {
+		return err
+	}
+
+	// if -N is set, we dont need a repo name and make the current directory name the reponame
+	name := l.repoName
+	var cloneOpts *remote.CloneOptions
+	if l.newrepo {
+		cloneOpts = &remote.CloneOptions{Progress: os.Stdout}
+		cloneOpts.Dir, err = os.Getwd()
+		if err != nil {
+			return err
+		}
+		name = filepath.Base(cloneOpts.Dir)
+	}
+
+	// List repos
+	if l.list || l.listLong {
+		err = listRepos(ctx, r, p, nil, l.listLong, provider.CloneProtocol)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create a remote repo and clone it if requested
+	if name != "" && !l.del {
+		opts := &remote.CreateOptions{Visibility: legacyVisibility(provider.Type, l.private)}
+		err = createRepo(ctx, r, name, opts, cloneOpts, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Delete a remote repo
+	if name != "" && l.del {
+		err = deleteRepo(ctx, r, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// legacyVisibility returns the visibility of new repositories of the deprecated form.
+// Without -P repositories were public, on GitLab internal. Other providers use their default.
+func legacyVisibility(typ string, private bool) remote.Visibility {
+
+	if private {
+		return remote.VisibilityPrivate
+	}
+	switch typ {
+	case "github", "gitea":
+		return remote.VisibilityPublic
+	case "gitlab":
+		return remote.VisibilityInternal
+	}
+
+	return ""
+}
@@ -0,0 +1,110 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wpueschel/gitrc/remote"
+	"github.com/wpueschel/gitrc/remote/fakeforge"
+)
+
+// writeConfig writes a config file with the given remotes and returns its path
+func writeConfig(t *testing.T, remotes map[string]remote.Provider) string {
+
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "gitrc-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	data, err := json.Marshal(remotes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "gitrc.json")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLegacyVisibility(t *testing.T) {
+
+	tests := []struct {
+		flavour string
+		private bool
+		want    remote.Visibility
+	}{
+		{fakeforge.GitHub, false, remote.VisibilityPublic},
+		{fakeforge.GitHub, true, remote.VisibilityPrivate},
+		{fakeforge.Gitea, false, remote.VisibilityPublic},
+		{fakeforge.Gitea, true, remote.VisibilityPrivate},
+		{fakeforge.GitLab, false, remote.VisibilityInternal},
+		{fakeforge.GitLab, true, remote.VisibilityPrivate},
+	}
+
+	for _, tt := range tests {
+		s := fakeforge.New(tt.flavour, "alice")
+		defer s.Close()
+
+		// The type is derived from the name of the remote
+		p := s.Provider()
+		p.Type = ""
+		args := []string{"-c", writeConfig(t, map[string]remote.Provider{tt.flavour: p}), "-n", "legacy", tt.flavour}
+		if tt.private {
+			args = append([]string{"-P"}, args...)
+		}
+
+		root := newRootCommand(context.Background())
+		if !isLegacy(root, args) {
+			t.Fatalf("%s is not the legacy form", args)
+		}
+		if err := runLegacy(root, args); err != nil {
+			t.Fatalf("%s: %s", args, err)
+		}
+
+		repo, ok := s.Repo("alice/legacy")
+		if !ok {
+			t.Fatalf("%s: repository was not created", args)
+		}
+		if repo.Visibility != tt.want {
+			t.Errorf("%s: created a %s repository, want %s", args, repo.Visibility, tt.want)
+		}
+	}
+}
+
+func TestLegacyHelp(t *testing.T) {
+
+	root := newRootCommand(context.Background())
+	for _, args := range [][]string{{"-h"}, {"--help"}, {"-h", "github"}, {"-c", "gitrc.json", "--help"}} {
+		if isLegacy(root, args) {
+			t.Errorf("%s is the legacy form, want help of the command line", args)
+		}
+	}
+	if !isLegacy(root, []string{"-l", "github"}) {
+		t.Errorf("-l github is not the legacy form")
+	}
+}
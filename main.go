@@ -17,8 +17,11 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 // version will be set during build (-ldflags)
@@ -26,72 +29,34 @@ var version string
 
 func main() {
 
-	// Vars we need here
-	var remote Remote
-	var config *Config
-	var err error
-	var providers = []string{"gitea", "github", "gitlab"}
-
-	// Conftype is allways the last command line parameter
-	provider := os.Args[len(os.Args)-1]
-
-	// Get a config
-	config, err = NewConfig()
-	if err != nil {
-		log.Fatalf("Could not read config: %s", err)
-	}
-
-	switch provider {
-
-	case "gitea":
-		// Set remote
-		remote = NewGiteaRemote(config)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	case "gitlab":
-		// Set remote
-		remote = NewGitlabRemote(config)
+	// Cancel running requests and clones on the first interrupt, exit on the second
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Printf("Interrupted, cancelling...")
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
 
-	case "github":
-		// Set remote
-		remote = NewGithubRemote(config)
+	root := newRootCommand(ctx)
+	args := os.Args[1:]
 
-	case "version":
-		log.Printf("Version: %s\n", version)
-		os.Exit(0)
-
-	default:
-		log.Fatalf("Unknown provider: %s\nTry -h [provider] where provider type can be one of: %s", provider, providers)
-	}
-
-	// List repos
-	if config.list || config.listLong {
-		err = remote.ListRepos()
-		if err != nil {
-			log.Fatalf("Could not list repos: %s\n", err)
-		}
+	var err error
+	if isLegacy(root, args) {
+		err = runLegacy(root, args)
+	} else {
+		err = root.execute(args)
 	}
 
-	// Create a remote repo
-	if config.repoName != "" && !config.del {
-		err := remote.CreateRepo()
-		if err != nil {
-			log.Fatalf("Could not create repository %s: %s\n", config.repoName, err)
-		}
-		// Clone the remote repo
-		if config.newrepo {
-			err := remote.CloneRepo()
-			if err != nil {
-				log.Fatalf("Could not clone the remote repository %s: %s\n", config.repoName, err)
-			}
-		}
+	if err == errUsage {
+		os.Exit(2)
 	}
-
-	// Delete a remote repo
-	if config.repoName != "" && config.del {
-		err := remote.DeleteRepo()
-		if err != nil {
-			log.Fatalf("Could not delete repository %s: %s\n", config.repoName, err)
-		}
+	if err != nil {
+		log.Fatal(err)
 	}
-
 }
@@ -0,0 +1,410 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Output formats
+const (
+	outputTable    = "table"
+	outputJSON     = "json"
+	outputYAML     = "yaml"
+	outputCSV      = "csv"
+	outputTemplate = "template"
+)
+
+// outputFormats contains all supported output formats
+var outputFormats = []string{outputTable, outputJSON, outputYAML, outputCSV, outputTemplate}
+
+// printer renders the results of a command in the selected output format.
+// Results are structs or slices of structs, the columns of table and csv output
+// are named after the json tags of the struct fields.
+type printer struct {
+	w        io.Writer
+	format   string
+	template string
+	columns  []string
+}
+
+// newPrinter creates a printer from the global options
+func newPrinter(w io.Writer, o *options) (*printer, error) {
+
+	p := &printer{
+		w:        w,
+		format:   o.output,
+		template: o.template,
+	}
+
+	if o.columns != "" {
+		for _, c := range strings.Split(o.columns, ",") {
+			p.columns = append(p.columns, strings.TrimSpace(c))
+		}
+	}
+
+	// A template implies the template format
+	if p.template != "" && p.format == outputTable {
+		p.format = outputTemplate
+	}
+
+	switch p.format {
+	case outputTable, outputJSON, outputYAML, outputCSV:
+	case outputTemplate:
+		if p.template == "" {
+			return nil, fmt.Errorf("Output format %s needs a --template", outputTemplate)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown output format: %s, output format can be one of: %s", p.format, outputFormats)
+	}
+
+	return p, nil
+}
+
+// print renders v, which is a struct, a pointer to a struct or a slice of those.
+// defaultColumns are used for table output, if no columns were selected.
+func (p *printer) print(v interface{}, defaultColumns ...string) error {
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice {
+		i := 0
+		next := func() (interface{}, error) {
+			if i >= rv.Len() {
+				return nil, nil
+			}
+			i++
+			return rv.Index(i - 1).Interface(), nil
+		}
+		return p.printList(rv.Type().Elem(), next, defaultColumns...)
+	}
+
+	switch p.format {
+	case outputJSON:
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(out)
+		return err
+	}
+
+	return p.printList(rv.Type(), func() (interface{}, error) {
+		item := v
+		v = nil
+		return item, nil
+	}, defaultColumns...)
+}
+
+// printList renders the items of type t returned by next, until next returns nil.
+// Items are written as soon as they are returned, only table output is aligned and written at the end.
+func (p *printer) printList(t reflect.Type, next func() (interface{}, error), defaultColumns ...string) error {
+
+	switch p.format {
+	case outputJSON:
+		return p.printJSONList(next)
+	case outputYAML:
+		return p.printYAMLList(next)
+	case outputTemplate:
+		return p.printTemplate(next)
+	case outputCSV:
+		return p.printCSV(t, next)
+	}
+
+	return p.printTable(t, next, defaultColumns)
+}
+
+// printJSONList prints the items as a json array
+func (p *printer) printJSONList(next func() (interface{}, error)) error {
+
+	sep := "[\n  "
+	for {
+		item, err := next()
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			break
+		}
+		out, err := json.MarshalIndent(item, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(p.w, "%s%s", sep, out)
+		sep = ",\n  "
+	}
+
+	if sep == "[\n  " {
+		_, err := fmt.Fprintln(p.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(p.w, "\n]")
+	return err
+}
+
+// printYAMLList prints the items as a yaml sequence
+func (p *printer) printYAMLList(next func() (interface{}, error)) error {
+
+	empty := true
+	for {
+		item, err := next()
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			break
+		}
+		out, err := yaml.Marshal([]interface{}{item})
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(out)
+		if err != nil {
+			return err
+		}
+		empty = false
+	}
+
+	if empty {
+		_, err := fmt.Fprintln(p.w, "[]")
+		return err
+	}
+	return nil
+}
+
+// printTemplate executes the template for every item
+func (p *printer) printTemplate(next func() (interface{}, error)) error {
+
+	tmpl, err := template.New("output").Parse(p.template)
+	if err != nil {
+		return fmt.Errorf("Could not parse template: %s", err)
+	}
+
+	for {
+		item, err := next()
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return nil
+		}
+		err = tmpl.Execute(p.w, item)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(p.w)
+	}
+}
+
+// printCSV prints the items as csv with a header line
+func (p *printer) printCSV(t reflect.Type, next func() (interface{}, error)) error {
+
+	columns, err := p.selectColumns(t, nil)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(p.w)
+	err = w.Write(columns)
+	if err != nil {
+		return err
+	}
+	for {
+		item, err := next()
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			break
+		}
+		err = w.Write(rowOf(reflect.Indirect(reflect.ValueOf(item)), columns))
+		if err != nil {
+			return err
+		}
+		w.Flush()
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+// printTable prints the items as an aligned table with a header line
+func (p *printer) printTable(t reflect.Type, next func() (interface{}, error), defaultColumns []string) error {
+
+	columns, err := p.selectColumns(t, defaultColumns)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+	for {
+		item, err := next()
+		if err != nil {
+			w.Flush()
+			return err
+		}
+		if item == nil {
+			break
+		}
+		fmt.Fprintln(w, strings.Join(rowOf(reflect.Indirect(reflect.ValueOf(item)), columns), "\t"))
+	}
+
+	return w.Flush()
+}
+
+// selectColumns returns the selected columns and checks if they exist.
+// Without a selection the default columns or, if there are none, all columns are returned.
+func (p *printer) selectColumns(t reflect.Type, defaultColumns []string) ([]string, error) {
+
+	all := columnsOf(elemType(t))
+
+	if len(p.columns) == 0 {
+		if len(defaultColumns) > 0 {
+			return defaultColumns, nil
+		}
+		return all, nil
+	}
+
+	for _, c := range p.columns {
+		found := false
+		for _, a := range all {
+			if c == a {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown column: %s, column can be one of: %s", c, all)
+		}
+	}
+
+	return p.columns, nil
+}
+
+// elemType returns the struct type of v, which may be a struct, a pointer or a slice
+func elemType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
+
+// columnName returns the column name of a struct field or "" if the field is not exported
+func columnName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// columnsOf returns all column names of a struct type, embedded structs are flattened
+func columnsOf(t reflect.Type) []string {
+
+	var columns []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			columns = append(columns, columnsOf(f.Type)...)
+			continue
+		}
+		if name := columnName(f); name != "" {
+			columns = append(columns, name)
+		}
+	}
+
+	return columns
+}
+
+// rowOf returns the formatted values of the columns of a struct
+func rowOf(v reflect.Value, columns []string) []string {
+
+	row := make([]string, len(columns))
+	for i, c := range columns {
+		row[i] = format(fieldByColumn(v, c))
+	}
+
+	return row
+}
+
+// fieldByColumn returns the value of the field with the given column name
+func fieldByColumn(v reflect.Value, column string) reflect.Value {
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if fv := fieldByColumn(v.Field(i), column); fv.IsValid() {
+				return fv
+			}
+			continue
+		}
+		if columnName(f) == column {
+			return v.Field(i)
+		}
+	}
+
+	return reflect.Value{}
+}
+
+// format formats a single value for table and csv output
+func format(v reflect.Value) string {
+
+	if !v.IsValid() {
+		return ""
+	}
+
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	case fmt.Stringer:
+		return value.String()
+	}
+
+	if v.Kind() == reflect.Slice {
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = format(v.Index(i))
+		}
+		return strings.Join(values, ",")
+	}
+
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,112 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wpueschel/gitrc/remote"
+)
+
+// newPluginCommand creates the plugin command and its subcommands
+func newPluginCommand() *command {
+
+	c := &command{
+		name:  "plugin",
+		short: "Work with provider plugins",
+	}
+
+	return c.add(
+		newPluginCheckCommand(),
+	)
+}
+
+// newPluginCheckCommand creates the plugin check command
+func newPluginCheckCommand() *command {
+
+	var write bool
+
+	c := &command{
+		name:  "check",
+		usage: "check [flags] <type|path>",
+		short: "Check that a plugin follows the plugin protocol",
+		long: `Starts the plugin gitrc-provider-<type> found on PATH, or the plugin at path, and checks its responses.
+The settings of the remote given with --provider are passed to the plugin.
+Only requests, which don't change anything, are sent unless --write is given.
+With --write a temporary repository is created, its clone urls are resolved and it is deleted again.`,
+	}
+
+	c.setFlags = func(fs *flag.FlagSet) {
+		fs.BoolVar(&write, "write", false, "Also check create, clone_url and delete with a temporary repository")
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 1, 1); err != nil {
+			return err
+		}
+
+		path, err := remote.FindPlugin(args[0])
+		if err != nil {
+			return err
+		}
+
+		provider := remote.Provider{Type: strings.TrimPrefix(filepath.Base(path), remote.PluginPrefix)}
+		if c.opts.provider != "" {
+			config, err := remote.NewConfig(c.opts.configFile)
+			if err != nil {
+				return fmt.Errorf("Could not read config: %s", err)
+			}
+			typ, err := config.Type(c.opts.provider)
+			if err != nil {
+				return err
+			}
+			provider = config.Provider[c.opts.provider]
+			provider.Type = typ
+		}
+
+		p, err := newPrinter(os.Stdout, c.opts)
+		if err != nil {
+			return err
+		}
+
+		checks := remote.CheckPlugin(ctx, path, provider, write)
+		err = p.print(checks, "check", "result", "message")
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, check := range checks {
+			if check.Result == remote.PluginCheckFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("Plugin %s failed %d of %d checks", path, failed, len(checks))
+		}
+
+		return nil
+	}
+
+	return c
+}
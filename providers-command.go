@@ -0,0 +1,109 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/wpueschel/gitrc/remote"
+)
+
+// providerCapabilities is a row of the capability matrix printed by the providers command
+type providerCapabilities struct {
+	Name                string `json:"name" yaml:"name"`
+	Type                string `json:"type" yaml:"type"`
+	remote.Capabilities `yaml:",inline"`
+	remote.Features     `yaml:",inline"`
+	// Plugin is the path of the plugin serving the remote, the capabilities of plugins are unknown
+	Plugin string `json:"plugin,omitempty" yaml:"plugin,omitempty"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// newProvidersCommand creates the providers command
+func newProvidersCommand() *command {
+
+	c := &command{
+		name:  "providers",
+		short: "Print the capabilities of the configured remotes",
+		long: `Prints the capability matrix of all configured remotes or, if --provider is given, of a single remote.
+The visibilities of new repositories, the clone protocols, the list types and the list order are those of the provider type.
+The features set_visibility, archive, rename and fork are the repo subcommands the remote supports.
+Remotes are created without connecting to the provider, remotes that can't be created show the error.`,
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 0, 0); err != nil {
+			return err
+		}
+
+		config, err := remote.NewConfig(c.opts.configFile)
+		if err != nil {
+			return fmt.Errorf("Could not read config: %s", err)
+		}
+
+		p, err := newPrinter(os.Stdout, c.opts)
+		if err != nil {
+			return err
+		}
+
+		var rows []providerCapabilities
+		for _, name := range config.Names() {
+			if c.opts.provider != "" && c.opts.provider != name {
+				continue
+			}
+			row, err := capabilitiesOf(config, name)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		if c.opts.provider != "" && len(rows) == 0 {
+			return fmt.Errorf("Remote %s is not configured in %s", c.opts.provider, c.opts.configFile)
+		}
+
+		return p.print(rows, "name", "type", "visibilities", "protocols", "set_visibility", "archive", "rename", "fork", "plugin", "error")
+	}
+
+	return c
+}
+
+// capabilitiesOf returns the capabilities of the configured remote name
+func capabilitiesOf(config *remote.Config, name string) (providerCapabilities, error) {
+
+	typ, err := config.Type(name)
+	if err != nil {
+		return providerCapabilities{}, err
+	}
+
+	row := providerCapabilities{Name: name, Type: typ}
+	row.Capabilities, _ = remote.ProviderCapabilities(typ)
+
+	r, err := config.Remote(name)
+	if err != nil {
+		row.Error = err.Error()
+		return row, nil
+	}
+	row.Features = remote.FeaturesOf(r)
+	if plugin, ok := r.(*remote.PluginRemote); ok {
+		row.Plugin = plugin.Path
+	}
+
+	return row, nil
+}
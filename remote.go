@@ -1,29 +0,0 @@
-/*
-   Copyright 2018 Wilhelm Peter Püschel
-
-   Licensed under the Apache License, Version 2.0 (the "License");
-   you may not use this file except in compliance with the License.
-   You may obtain a copy of the License at
-
-       http://www.apache.org/licenses/LICENSE-2.0
-
-   Unless required by applicable law or agreed to in writing, software
-   distributed under the License is distributed on an "AS IS" BASIS,
-   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-   See the License for the specific language governing permissions and
-   limitations under the License.
-*/
-
-package main
-
-// Remote is a client for a remote git provider
-type Remote interface {
-	// Function CreateRepo creates a new remote repository
-	CreateRepo() error
-	// Function CloneRepo clones the remote repository
-	CloneRepo() error
-	// Functon DeleteRepo deletes a remote repository
-	DeleteRepo() error
-	// Function ListRepos list all remote repositories
-	ListRepos() error
-}
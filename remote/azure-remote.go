@@ -0,0 +1,378 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// azurePerPage is the number of repositories, whose last update is fetched at once
+const azurePerPage = 20
+
+// azureAPIVersion is the version of the Azure DevOps REST api
+const azureAPIVersion = "6.0"
+
+// azureURL is the url of Azure DevOps Services
+const azureURL = "https://dev.azure.com"
+
+func init() {
+	Register("azure", func(p Provider) (Remote, error) { return NewAzureRemote(p) }, Capabilities{
+		Protocols: []string{"ssh", "http"},
+		ListOrder: ListOrderName,
+	})
+}
+
+// AzureRemote implements Remote for Azure DevOps Repos.
+// Repositories belong to a project of the organisation, which is the owner.
+type AzureRemote struct {
+	Provider   Provider
+	HTTPClient *http.Client
+
+	rest *restClient
+}
+
+// azureProject is a project of the Azure DevOps api
+type azureProject struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Visibility string `json:"visibility"`
+}
+
+// azureRepo is a repository of the Azure DevOps api
+type azureRepo struct {
+	ID            string       `json:"id"`
+	Name          string       `json:"name"`
+	Project       azureProject `json:"project"`
+	DefaultBranch string       `json:"defaultBranch"`
+	Size          int64        `json:"size"`
+	RemoteURL     string       `json:"remoteUrl"`
+	SSHURL        string       `json:"sshUrl"`
+	WebURL        string       `json:"webUrl"`
+	IsDisabled    bool         `json:"isDisabled"`
+}
+
+// azureCommit is a commit of the Azure DevOps api
+type azureCommit struct {
+	Committer struct {
+		Date time.Time `json:"date"`
+	} `json:"committer"`
+}
+
+// project returns the project and the name of a repository given as "project/name" or "name"
+func (a *AzureRemote) project(name string) (string, string) {
+
+	project, name := splitName(name)
+	if project == "" {
+		project = a.Provider.Project
+	}
+
+	return project, name
+}
+
+// api returns the path of an api resource of project with the api version
+func (a *AzureRemote) api(project, resource string) string {
+
+	sep := "?"
+	if strings.Contains(resource, "?") {
+		sep = "&"
+	}
+
+	return fmt.Sprintf("%s/%s/_apis/%s%sapi-version=%s", url.PathEscape(a.Provider.Owner), url.PathEscape(project), resource, sep, azureAPIVersion)
+}
+
+// getProject fetches a project of the organisation
+func (a *AzureRemote) getProject(ctx context.Context, project string) (*azureProject, error) {
+
+	p := new(azureProject)
+	path := fmt.Sprintf("%s/_apis/projects/%s?api-version=%s", url.PathEscape(a.Provider.Owner), url.PathEscape(project), azureAPIVersion)
+	err := a.rest.do(ctx, "GET", path, nil, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// getRepo fetches the repository name
+func (a *AzureRemote) getRepo(ctx context.Context, name string) (*azureRepo, error) {
+
+	project, name := a.project(name)
+
+	repo := new(azureRepo)
+	err := a.rest.do(ctx, "GET", a.api(project, "git/repositories/"+url.PathEscape(name)), nil, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// updated fetches the date of the last commit on the default branch of repo with a single request for its top commit.
+// It is zero for empty repositories and disabled ones, whose commits can't be read.
+func (a *AzureRemote) updated(ctx context.Context, repo *azureRepo) (time.Time, error) {
+
+	if repo.DefaultBranch == "" || repo.IsDisabled {
+		return time.Time{}, nil
+	}
+
+	query := url.Values{}
+	query.Set("searchCriteria.$top", "1")
+	query.Set("searchCriteria.itemVersion.version", strings.TrimPrefix(repo.DefaultBranch, "refs/heads/"))
+
+	result := struct {
+		Value []azureCommit `json:"value"`
+	}{}
+	err := a.rest.do(ctx, "GET", a.api(repo.Project.Name, fmt.Sprintf("git/repositories/%s/commits?%s", repo.ID, query.Encode())), nil, &result)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(result.Value) == 0 {
+		return time.Time{}, nil
+	}
+
+	return result.Value[0].Committer.Date, nil
+}
+
+// CreateRepo creates a remote repository in the project.
+// Repositories have the visibility of their project, which has to be the requested visibility, private by default.
+func (a *AzureRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	visibility, err := opts.visibility(a.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	projectName, name := a.project(name)
+	project, err := a.getProject(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	if string(visibility) != project.Visibility {
+		return nil, fmt.Errorf("Repositories of the %s project %s can't be %s", project.Visibility, project.Name, visibility)
+	}
+
+	// Create repo
+	body := map[string]interface{}{"name": name, "project": map[string]string{"id": project.ID}}
+	repo := new(azureRepo)
+	err = a.rest.do(ctx, "POST", a.api(projectName, "git/repositories"), body, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a basic README with an initial push to the default branch of the api, which is master, if it has none yet
+	if repo.DefaultBranch == "" {
+		repo.DefaultBranch = "refs/heads/master"
+	}
+	push := map[string]interface{}{
+		"refUpdates": []map[string]string{{"name": repo.DefaultBranch, "oldObjectId": strings.Repeat("0", 40)}},
+		"commits": []map[string]interface{}{{
+			"comment": "Added a README",
+			"changes": []map[string]interface{}{{
+				"changeType": "add",
+				"item":       map[string]string{"path": "/README.md"},
+				"newContent": map[string]string{"content": fmt.Sprintf("# %s\n", name), "contentType": "rawtext"},
+			}},
+		}},
+	}
+	err = a.rest.do(ctx, "POST", a.api(projectName, fmt.Sprintf("git/repositories/%s/pushes", repo.ID)), push, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return azureRepository(repo, time.Now()), nil
+}
+
+// CloneRepo clones the remote repository
+func (a *AzureRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	var endpoint *transport.Endpoint
+
+	repo, err := a.getRepo(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// Define a git endpoint
+	switch a.Provider.CloneProtocol {
+	case "ssh", "":
+		endpoint, err = transport.NewEndpoint(repo.SSHURL)
+	case "http":
+		endpoint, err = transport.NewEndpoint(repo.RemoteURL)
+		if err == nil {
+			// Personal access tokens work with any user name
+			endpoint.User, endpoint.Password = a.Provider.User, a.Provider.Token
+			if endpoint.User == "" {
+				endpoint.User = "pat"
+			}
+		}
+	default:
+		err = fmt.Errorf("Unknown clone protocol %s", a.Provider.CloneProtocol)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := sshAuth(a.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository
+func (a *AzureRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	// Repositories can only be deleted by their id
+	repo, err := a.getRepo(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	err = a.rest.do(ctx, "DELETE", a.api(repo.Project.Name, "git/repositories/"+repo.ID), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos lists the repos of the project sorted by name.
+// The api returns all repositories at once, their last update is fetched page by page from the commits api.
+func (a *AzureRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	project := opts.owner()
+	if project == "" {
+		project = a.Provider.Project
+	}
+
+	var all []*azureRepo
+
+	return NewRepoIterator(ctx, opts, azurePerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		if page == 1 {
+			result := struct {
+				Value []*azureRepo `json:"value"`
+			}{}
+			err := a.rest.do(ctx, "GET", a.api(project, "git/repositories"), nil, &result)
+			if err != nil {
+				return nil, 0, err
+			}
+			all = result.Value
+			sort.Slice(all, func(i, j int) bool {
+				return all[i].Project.Name+"/"+all[i].Name < all[j].Project.Name+"/"+all[j].Name
+			})
+		}
+
+		start := (page - 1) * perPage
+		end := start + perPage
+		if end >= len(all) {
+			end = len(all)
+		}
+		if start >= end {
+			return nil, 0, nil
+		}
+
+		repos := make([]*Repository, 0, end-start)
+		for _, r := range all[start:end] {
+			updated, err := a.updated(ctx, r)
+			if err != nil {
+				return nil, 0, err
+			}
+			repos = append(repos, azureRepository(r, updated))
+		}
+
+		next := page + 1
+		if end == len(all) {
+			next = 0
+		}
+
+		return repos, next, nil
+	})
+}
+
+// azureRepository converts an azure repository into a Repository
+func azureRepository(r *azureRepo, updated time.Time) *Repository {
+
+	return &Repository{
+		Name:          r.Name,
+		FullName:      r.Project.Name + "/" + r.Name,
+		Visibility:    Visibility(r.Project.Visibility),
+		DefaultBranch: strings.TrimPrefix(r.DefaultBranch, "refs/heads/"),
+		SSHURL:        r.SSHURL,
+		HTTPURL:       r.RemoteURL,
+		WebURL:        r.WebURL,
+		Updated:       updated,
+		Archived:      r.IsDisabled,
+		Size:          r.Size / 1024,
+	}
+}
+
+// azureMessage extracts the message of an azure error response
+func azureMessage(body []byte) string {
+
+	e := struct {
+		Message string `json:"message"`
+	}{}
+	if json.Unmarshal(body, &e) != nil {
+		return ""
+	}
+
+	return e.Message
+}
+
+// NewAzureRemote creates a new Remote object and returns it.
+// Requests are authenticated with a personal access token.
+func NewAzureRemote(p Provider) (*AzureRemote, error) {
+
+	if p.Owner == "" {
+		return nil, fmt.Errorf("No owner configured for azure, the organisation is unknown")
+	}
+
+	remote := new(AzureRemote)
+
+	if p.Type == "" {
+		p.Type = "azure"
+	}
+
+	baseURL := p.HostBaseURL
+	if baseURL == "" {
+		baseURL = azureURL
+	}
+
+	remote.Provider = p
+	remote.HTTPClient = new(http.Client)
+	remote.rest = &restClient{
+		baseURL:    baseURL,
+		httpClient: remote.HTTPClient,
+		message:    azureMessage,
+		authorize: func(req *http.Request) {
+			req.SetBasicAuth(p.User, p.Token)
+		},
+	}
+
+	return remote, nil
+}
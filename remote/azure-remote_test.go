@@ -0,0 +1,443 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// azureToken is the personal access token the stand-in accepts
+const azureToken = "azure-token"
+
+// azureStandIn is a local stand-in of the Azure DevOps api for the organisation acme with the private project tools.
+// Repositories are bare repositories served by git http-backend, pushes of the api commit to them.
+type azureStandIn struct {
+	server *httptest.Server
+	dir    string
+
+	// defaultBranch is returned for new repositories, as if the organisation configured it
+	defaultBranch string
+
+	mu      sync.Mutex
+	repos   []*azureRepo
+	updates map[string]time.Time
+	nextID  int
+	pushes  []string
+	commits []string
+}
+
+// newAzureStandIn starts a stand-in with a temporary directory for the repositories, both are removed at the end of the test
+func newAzureStandIn(t *testing.T) *azureStandIn {
+
+	dir, err := ioutil.TempDir("", "gitrc-azure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &azureStandIn{dir: dir, updates: make(map[string]time.Time)}
+	backend := &cgi.Handler{
+		Path: filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend"),
+		Root: "/acme/tools/_git",
+		Env:  []string{"GIT_PROJECT_ROOT=" + dir, "GIT_HTTP_EXPORT_ALL=1"},
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if _, token, ok := r.BasicAuth(); !ok || token != azureToken {
+			w.Header().Set("WWW-Authenticate", `Basic realm="azure"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/acme/tools/_git/") {
+			backend.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Query().Get("api-version") != azureAPIVersion {
+			s.error(w, http.StatusBadRequest, "The api version is missing")
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/acme/_apis/projects/tools" && r.Method == "GET":
+			s.writeJSON(w, http.StatusOK, s.project())
+		case r.URL.Path == "/acme/tools/_apis/git/repositories" && r.Method == "GET":
+			s.writeJSON(w, http.StatusOK, map[string]interface{}{"value": s.repos, "count": len(s.repos)})
+		case r.URL.Path == "/acme/tools/_apis/git/repositories" && r.Method == "POST":
+			s.create(w, r)
+		case strings.HasPrefix(r.URL.Path, "/acme/tools/_apis/git/repositories/"):
+			s.serveRepo(w, r, strings.Split(strings.TrimPrefix(r.URL.Path, "/acme/tools/_apis/git/repositories/"), "/"))
+		default:
+			s.error(w, http.StatusNotFound, fmt.Sprintf("Unknown resource %s", r.URL.Path))
+		}
+	}))
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// remote returns an AzureRemote of the project tools using the stand-in, which clones over http
+func (s *azureStandIn) remote(t *testing.T) *AzureRemote {
+
+	r, err := NewAzureRemote(Provider{HostBaseURL: s.server.URL, Token: azureToken, Owner: "acme", Project: "tools", CloneProtocol: "http"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+// writeJSON writes v with status
+func (s *azureStandIn) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// error writes an error response with message like azure does
+func (s *azureStandIn) error(w http.ResponseWriter, status int, message string) {
+	s.writeJSON(w, status, map[string]string{"message": message})
+}
+
+// project returns the private project tools
+func (s *azureStandIn) project() azureProject {
+	return azureProject{ID: "project-tools", Name: "tools", Visibility: "private"}
+}
+
+// addRepo adds a repository without a bare repository, which was last updated at updated, if it has a default branch
+func (s *azureStandIn) addRepo(name, defaultBranch string, updated time.Time) *azureRepo {
+
+	s.nextID++
+	repo := &azureRepo{
+		ID:            fmt.Sprintf("id-%d", s.nextID),
+		Name:          name,
+		Project:       s.project(),
+		DefaultBranch: defaultBranch,
+		RemoteURL:     s.server.URL + "/acme/tools/_git/" + name,
+		SSHURL:        "git@ssh.dev.azure.com:v3/acme/tools/" + name,
+		WebURL:        s.server.URL + "/acme/tools/_git/" + name,
+	}
+	s.repos = append(s.repos, repo)
+	s.updates[repo.ID] = updated
+
+	return repo
+}
+
+// find returns the repository with the given name or id
+func (s *azureStandIn) find(key string) *azureRepo {
+	for _, repo := range s.repos {
+		if repo.Name == key || repo.ID == key {
+			return repo
+		}
+	}
+	return nil
+}
+
+// git runs a shell script with git in the bare repository of repo
+func (s *azureStandIn) git(repo *azureRepo, script string, args ...string) (string, error) {
+
+	c := exec.Command("sh", append([]string{"-c", script, "sh"}, args...)...)
+	c.Dir = filepath.Join(s.dir, repo.Name)
+	c.Env = append(os.Environ(), "GIT_AUTHOR_NAME=azure", "GIT_AUTHOR_EMAIL=azure@example.com", "GIT_COMMITTER_NAME=azure", "GIT_COMMITTER_EMAIL=azure@example.com")
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", err, out)
+	}
+
+	return string(out), nil
+}
+
+// create creates an empty repository in the project given by id
+func (s *azureStandIn) create(w http.ResponseWriter, r *http.Request) {
+
+	body := struct {
+		Name    string       `json:"name"`
+		Project azureProject `json:"project"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Project.ID != s.project().ID {
+		s.error(w, http.StatusBadRequest, "The project id is invalid")
+		return
+	}
+	if s.find(body.Name) != nil {
+		s.error(w, http.StatusConflict, fmt.Sprintf("TF400948: A Git repository with the name %s already exists.", body.Name))
+		return
+	}
+
+	if err := os.Mkdir(filepath.Join(s.dir, body.Name), 0755); err != nil {
+		s.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	repo := s.addRepo(body.Name, s.defaultBranch, time.Time{})
+	if _, err := s.git(repo, "git init --bare -q ."); err != nil {
+		s.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, repo)
+}
+
+// serveRepo answers the requests of a repository, segs are the path after the repositories
+func (s *azureStandIn) serveRepo(w http.ResponseWriter, r *http.Request, segs []string) {
+
+	repo := s.find(segs[0])
+	if repo == nil {
+		s.error(w, http.StatusNotFound, fmt.Sprintf("TF401019: The Git repository with name or identifier %s does not exist", segs[0]))
+		return
+	}
+
+	switch {
+	case len(segs) == 1 && r.Method == "GET":
+		s.writeJSON(w, http.StatusOK, repo)
+	case len(segs) == 1 && r.Method == "DELETE" && segs[0] == repo.ID:
+		for i := range s.repos {
+			if s.repos[i] == repo {
+				s.repos = append(s.repos[:i], s.repos[i+1:]...)
+				break
+			}
+		}
+		os.RemoveAll(filepath.Join(s.dir, repo.Name))
+		w.WriteHeader(http.StatusNoContent)
+	case len(segs) == 2 && segs[1] == "commits" && r.Method == "GET":
+		s.commits = append(s.commits, repo.Name+" "+r.URL.RawQuery)
+		if repo.IsDisabled {
+			s.error(w, http.StatusForbidden, "TF401019: The repository is disabled")
+			return
+		}
+		if r.URL.Query().Get("searchCriteria.$top") != "1" {
+			s.error(w, http.StatusBadRequest, "Only the top commit is served")
+			return
+		}
+		commit := azureCommit{}
+		commit.Committer.Date = s.updates[repo.ID]
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{"value": []azureCommit{commit}, "count": 1})
+	case len(segs) == 2 && segs[1] == "pushes" && r.Method == "POST":
+		s.push(w, r, repo)
+	default:
+		s.error(w, http.StatusNotFound, fmt.Sprintf("Unknown resource %s", r.URL.Path))
+	}
+}
+
+// push commits the added files of the first commit of a push to the branch of its first ref update
+func (s *azureStandIn) push(w http.ResponseWriter, r *http.Request, repo *azureRepo) {
+
+	body := struct {
+		RefUpdates []struct {
+			Name string `json:"name"`
+		} `json:"refUpdates"`
+		Commits []struct {
+			Comment string `json:"comment"`
+			Changes []struct {
+				Item struct {
+					Path string `json:"path"`
+				} `json:"item"`
+				NewContent struct {
+					Content string `json:"content"`
+				} `json:"newContent"`
+			} `json:"changes"`
+		} `json:"commits"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.RefUpdates) != 1 || len(body.Commits) != 1 || len(body.Commits[0].Changes) != 1 {
+		s.error(w, http.StatusBadRequest, "Only a single commit with a single file is supported")
+		return
+	}
+	ref := body.RefUpdates[0].Name
+	change := body.Commits[0].Changes[0]
+	s.pushes = append(s.pushes, ref+" "+change.Item.Path)
+
+	script := `blob=$(printf '%s' "$1" | git hash-object -w --stdin) &&
+		tree=$(printf '100644 blob %s\t%s\n' "$blob" "$2" | git mktree) &&
+		git update-ref "$3" "$(git commit-tree -m "$4" "$tree")" && git symbolic-ref HEAD "$3"`
+	if _, err := s.git(repo, script, change.NewContent.Content, strings.TrimPrefix(change.Item.Path, "/"), ref, body.Commits[0].Comment); err != nil {
+		s.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if repo.DefaultBranch == "" {
+		repo.DefaultBranch = ref
+	}
+	s.updates[repo.ID] = time.Now()
+
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{"pushId": len(s.pushes)})
+}
+
+func TestAzureCreateRepo(t *testing.T) {
+
+	s := newAzureStandIn(t)
+	r := s.remote(t)
+	ctx := context.Background()
+
+	repo, err := r.CreateRepo(ctx, "tool", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "tools/tool" || repo.Visibility != VisibilityPrivate || repo.DefaultBranch != "master" {
+		t.Errorf("Created %s with the visibility %s on %s, want a private tools/tool on master", repo.FullName, repo.Visibility, repo.DefaultBranch)
+	}
+	if repo.HTTPURL != s.server.URL+"/acme/tools/_git/tool" || repo.SSHURL != "git@ssh.dev.azure.com:v3/acme/tools/tool" {
+		t.Errorf("Repository has the urls %s and %s", repo.HTTPURL, repo.SSHURL)
+	}
+
+	// The README is pushed to the default branch of the api
+	s.defaultBranch = "refs/heads/main"
+	repo, err = r.CreateRepo(ctx, "tools/lib", &CreateOptions{Visibility: VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.DefaultBranch != "main" {
+		t.Errorf("Created tools/lib on %s, want main", repo.DefaultBranch)
+	}
+	if want := "[refs/heads/master /README.md refs/heads/main /README.md]"; fmt.Sprint(s.pushes) != want {
+		t.Errorf("Pushed %v, want %s", s.pushes, want)
+	}
+
+	// The visibility of the project is checked, even if the default visibility is requested
+	r.Provider.Visibility = VisibilityPublic
+	if _, err = r.CreateRepo(ctx, "web", nil); err == nil || !strings.Contains(err.Error(), "Repositories of the private project tools can't be public") {
+		t.Errorf("Creating a public repository in a private project returned %v", err)
+	}
+	if s.find("web") != nil {
+		t.Errorf("Repository with the wrong visibility was created")
+	}
+
+	r.Provider.Visibility = ""
+	if _, err = r.CreateRepo(ctx, "tool", nil); err == nil || !strings.Contains(err.Error(), "TF400948") {
+		t.Errorf("Creating an existing repository returned %v", err)
+	}
+}
+
+func TestAzureCloneRepo(t *testing.T) {
+
+	s := newAzureStandIn(t)
+	s.defaultBranch = "refs/heads/main"
+	r := s.remote(t)
+	ctx := context.Background()
+	if _, err := r.CreateRepo(ctx, "tool", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "gitrc-clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The clone checks out the default branch with the pushed README
+	err = r.CloneRepo(ctx, "tools/tool", &CloneOptions{Dir: filepath.Join(dir, "tool")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readme, err := ioutil.ReadFile(filepath.Join(dir, "tool", "README.md")); err != nil || string(readme) != "# tool\n" {
+		t.Errorf("Clone has the README %q: %v", readme, err)
+	}
+
+	err = r.CloneRepo(ctx, "missing", &CloneOptions{Dir: filepath.Join(dir, "missing")})
+	if err == nil || !strings.Contains(err.Error(), "TF401019") {
+		t.Errorf("Cloning a missing repository returned %v", err)
+	}
+}
+
+func TestAzureListRepos(t *testing.T) {
+
+	s := newAzureStandIn(t)
+	start := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	// The api lists in no defined order, the remote sorts by name
+	for i := 44; i >= 0; i-- {
+		s.addRepo(fmt.Sprintf("repo-%02d", i), "refs/heads/main", start.Add(time.Duration(i)*time.Hour))
+	}
+	s.addRepo("repo-empty", "", time.Time{})
+	s.addRepo("repo-off", "refs/heads/main", start).IsDisabled = true
+	r := s.remote(t)
+	ctx := context.Background()
+
+	repos, err := r.ListRepos(ctx, nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 47 {
+		t.Fatalf("Listed %d repositories, want 47", len(repos))
+	}
+	for i := 0; i < 45; i++ {
+		if want := fmt.Sprintf("tools/repo-%02d", i); repos[i].FullName != want || !repos[i].Updated.Equal(start.Add(time.Duration(i)*time.Hour)) {
+			t.Errorf("Repository %d is %s updated at %s, want %s", i, repos[i].FullName, repos[i].Updated, want)
+		}
+	}
+	if !repos[45].Updated.IsZero() || !repos[46].Updated.IsZero() || !repos[46].Archived {
+		t.Errorf("Empty and disabled repositories have the updates %s and %s", repos[45].Updated, repos[46].Updated)
+	}
+
+	// The top commit is requested once for each repository with commits
+	if len(s.commits) != 45 {
+		t.Errorf("Listing requested %d commits, want 45", len(s.commits))
+	}
+	for _, c := range s.commits {
+		if !strings.Contains(c, "searchCriteria.%24top=1") || !strings.Contains(c, "searchCriteria.itemVersion.version=main") {
+			t.Errorf("Commits were requested with %s, want the top commit of main", c)
+		}
+	}
+
+	// Only the commits of the listed page are requested
+	s.commits = nil
+	repos, err = r.ListRepos(ctx, &ListOptions{Limit: 5}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 5 || len(s.commits) != 5 {
+		t.Errorf("Listed %d repositories with %d commit requests, want 5", len(repos), len(s.commits))
+	}
+}
+
+func TestAzureDeleteRepo(t *testing.T) {
+
+	s := newAzureStandIn(t)
+	s.addRepo("tool", "", time.Time{})
+	r := s.remote(t)
+	ctx := context.Background()
+
+	if err := r.DeleteRepo(ctx, "tools/tool"); err != nil {
+		t.Fatal(err)
+	}
+	if s.find("tool") != nil {
+		t.Errorf("Repository was not deleted")
+	}
+	if err := r.DeleteRepo(ctx, "tool"); err == nil || !strings.Contains(err.Error(), "TF401019") {
+		t.Errorf("Deleting a missing repository returned %v, want not found", err)
+	}
+}
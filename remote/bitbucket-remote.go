@@ -0,0 +1,341 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// bitbucketPerPage is the maximum page size of the bitbucket api
+const bitbucketPerPage = 100
+
+// bitbucketAPIURL is the url of the Bitbucket Cloud api
+const bitbucketAPIURL = "https://api.bitbucket.org/2.0"
+
+func init() {
+	Register("bitbucket", func(p Provider) (Remote, error) { return NewBitbucketRemote(p) }, Capabilities{
+		Visibilities: []Visibility{VisibilityPublic, VisibilityPrivate},
+		Protocols:    []string{"ssh", "http"},
+		ListOrder:    ListOrderUpdated,
+	})
+}
+
+// BitbucketRemote implements Remote for Bitbucket Cloud.
+// Repositories belong to a workspace, which is the owner or the user, and optionally to a project.
+type BitbucketRemote struct {
+	Provider   Provider
+	HTTPClient *http.Client
+
+	rest *restClient
+}
+
+// bitbucketRepo is a repository of the Bitbucket 2.0 api
+type bitbucketRepo struct {
+	Name       string    `json:"name"`
+	FullName   string    `json:"full_name"`
+	IsPrivate  bool      `json:"is_private"`
+	Size       int64     `json:"size"`
+	CreatedOn  time.Time `json:"created_on"`
+	UpdatedOn  time.Time `json:"updated_on"`
+	MainBranch *struct {
+		Name string `json:"name"`
+	} `json:"mainbranch,omitempty"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+		Clone []struct {
+			Name string `json:"name"`
+			Href string `json:"href"`
+		} `json:"clone"`
+	} `json:"links"`
+}
+
+// bitbucketPage is a page of a bitbucket listing
+type bitbucketPage struct {
+	Values []*bitbucketRepo `json:"values"`
+	Next   string           `json:"next"`
+}
+
+// workspace returns the workspace and the name of a repository given as "workspace/name" or "name"
+func (b *BitbucketRemote) workspace(name string) (string, string) {
+
+	workspace, name := splitName(name)
+	if workspace == "" {
+		workspace = b.Provider.Owner
+	}
+
+	return workspace, name
+}
+
+// path returns the api path of the repository name
+func (b *BitbucketRemote) path(name string) string {
+	workspace, name := b.workspace(name)
+	return fmt.Sprintf("repositories/%s/%s", url.PathEscape(workspace), url.PathEscape(name))
+}
+
+// private maps visibility to the private flag of a bitbucket repository, bitbucket has no internal repositories
+func (b *BitbucketRemote) private(visibility Visibility) (bool, error) {
+
+	switch visibility {
+	case VisibilityPublic:
+		return false, nil
+	case VisibilityPrivate:
+		return true, nil
+	}
+
+	return false, unsupportedVisibility(b.Provider.Type, visibility)
+}
+
+// CreateRepo creates a remote repository in the configured project
+func (b *BitbucketRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	visibility, err := opts.visibility(b.Provider)
+	if err != nil {
+		return nil, err
+	}
+	private, err := b.private(visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create repo
+	body := map[string]interface{}{"scm": "git", "is_private": private}
+	if b.Provider.Project != "" {
+		body["project"] = map[string]string{"key": b.Provider.Project}
+	}
+	repo := new(bitbucketRepo)
+	err = b.rest.do(ctx, "POST", b.path(name), body, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a basic README, the src endpoint takes files as form fields
+	_, repoName := b.workspace(name)
+	form := url.Values{}
+	form.Set("README.md", fmt.Sprintf("# %s\n", repoName))
+	form.Set("message", "Added a README")
+	err = b.rest.send(ctx, "POST", b.path(name)+"/src", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return bitbucketRepository(repo), nil
+}
+
+// CloneRepo clones the remote repository
+func (b *BitbucketRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	var endpoint *transport.Endpoint
+
+	repo := new(bitbucketRepo)
+	err := b.rest.do(ctx, "GET", b.path(name), nil, repo)
+	if err != nil {
+		return err
+	}
+
+	urls := bitbucketRepository(repo)
+
+	// Define a git endpoint
+	switch b.Provider.CloneProtocol {
+	case "ssh", "":
+		endpoint, err = transport.NewEndpoint(urls.SSHURL)
+	case "http":
+		endpoint, err = transport.NewEndpoint(urls.HTTPURL)
+		if err == nil {
+			endpoint.User, endpoint.Password = b.Provider.User, b.Provider.Password
+			// Access tokens authenticate with a fixed user name
+			if b.Provider.Token != "" {
+				endpoint.User, endpoint.Password = "x-token-auth", b.Provider.Token
+			}
+		}
+	default:
+		err = fmt.Errorf("Unknown clone protocol %s", b.Provider.CloneProtocol)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := sshAuth(b.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository
+func (b *BitbucketRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	err := b.rest.do(ctx, "DELETE", b.path(name), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetVisibility changes the visibility of a (remote) repository
+func (b *BitbucketRemote) SetVisibility(ctx context.Context, name string, visibility Visibility) error {
+
+	private, err := b.private(visibility)
+	if err != nil {
+		return err
+	}
+
+	err = b.rest.do(ctx, "PUT", b.path(name), map[string]bool{"is_private": private}, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos lists the repos of the workspace, only those of the configured project if there is one
+func (b *BitbucketRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	workspace := opts.owner()
+	if workspace == "" {
+		workspace = b.Provider.Owner
+	}
+
+	query := url.Values{}
+	query.Set("sort", "-updated_on")
+	if b.Provider.Project != "" {
+		query.Set("q", fmt.Sprintf("project.key=\"%s\"", b.Provider.Project))
+	}
+
+	return NewRepoIterator(ctx, opts, bitbucketPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		query.Set("page", fmt.Sprint(page))
+		query.Set("pagelen", fmt.Sprint(perPage))
+
+		result := new(bitbucketPage)
+		err := b.rest.do(ctx, "GET", fmt.Sprintf("repositories/%s?%s", url.PathEscape(workspace), query.Encode()), nil, result)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		repos := make([]*Repository, 0, len(result.Values))
+		for _, r := range result.Values {
+			repos = append(repos, bitbucketRepository(r))
+		}
+
+		// The last page has no link to a next one
+		next := page + 1
+		if result.Next == "" {
+			next = 0
+		}
+
+		return repos, next, nil
+	})
+}
+
+// bitbucketRepository converts a bitbucket repository into a Repository
+func bitbucketRepository(r *bitbucketRepo) *Repository {
+
+	visibility := VisibilityPublic
+	if r.IsPrivate {
+		visibility = VisibilityPrivate
+	}
+
+	repo := &Repository{
+		Name:       r.Name,
+		FullName:   r.FullName,
+		Visibility: visibility,
+		WebURL:     r.Links.HTML.Href,
+		Created:    r.CreatedOn,
+		Updated:    r.UpdatedOn,
+		Size:       r.Size / 1024,
+	}
+	if r.MainBranch != nil {
+		repo.DefaultBranch = r.MainBranch.Name
+	}
+	for _, c := range r.Links.Clone {
+		switch c.Name {
+		case "ssh":
+			repo.SSHURL = c.Href
+		case "https":
+			repo.HTTPURL = c.Href
+		}
+	}
+
+	return repo
+}
+
+// bitbucketMessage extracts the message of a bitbucket error response
+func bitbucketMessage(body []byte) string {
+
+	e := struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	if json.Unmarshal(body, &e) != nil {
+		return ""
+	}
+
+	return e.Error.Message
+}
+
+// NewBitbucketRemote creates a new Remote object and returns it.
+// Access tokens are used as bearer tokens, otherwise the user authenticates with an app password.
+func NewBitbucketRemote(p Provider) (*BitbucketRemote, error) {
+
+	remote := new(BitbucketRemote)
+
+	if p.Type == "" {
+		p.Type = "bitbucket"
+	}
+	// The workspace defaults to the workspace of the user
+	if p.Owner == "" {
+		p.Owner = p.User
+	}
+	if p.Owner == "" {
+		return nil, fmt.Errorf("No owner or user configured for bitbucket, the workspace is unknown")
+	}
+
+	baseURL := p.HostBaseURL
+	if baseURL == "" {
+		baseURL = bitbucketAPIURL
+	}
+
+	remote.Provider = p
+	remote.HTTPClient = new(http.Client)
+	remote.rest = &restClient{
+		baseURL:    baseURL,
+		httpClient: remote.HTTPClient,
+		message:    bitbucketMessage,
+		authorize: func(req *http.Request) {
+			if p.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+p.Token)
+			} else if p.User != "" {
+				req.SetBasicAuth(p.User, p.Password)
+			}
+		},
+	}
+
+	return remote, nil
+}
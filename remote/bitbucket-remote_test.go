@@ -0,0 +1,407 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bitbucketToken is the token the stand-in accepts
+const bitbucketToken = "bitbucket-token"
+
+// bitbucketStandIn is a local stand-in of the parts of the Bitbucket 2.0 api used by BitbucketRemote.
+// Pages are at most maxPageLen repositories long, so listings need several pages.
+type bitbucketStandIn struct {
+	server     *httptest.Server
+	maxPageLen int
+
+	mu       sync.Mutex
+	repos    map[string]*bitbucketRepo
+	projects map[string]string
+	readmes  map[string]string
+	messages map[string]string
+	clock    time.Time
+	requests []string
+}
+
+// newBitbucketStandIn starts a stand-in, which is closed at the end of the test
+func newBitbucketStandIn(t *testing.T) *bitbucketStandIn {
+
+	b := &bitbucketStandIn{
+		maxPageLen: 3,
+		repos:      map[string]*bitbucketRepo{},
+		projects:   map[string]string{},
+		readmes:    map[string]string{},
+		messages:   map[string]string{},
+		clock:      time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	b.server = httptest.NewServer(http.HandlerFunc(b.serveHTTP))
+	t.Cleanup(b.server.Close)
+
+	return b
+}
+
+// remote returns a BitbucketRemote using the stand-in
+func (b *bitbucketStandIn) remote(t *testing.T, p Provider) *BitbucketRemote {
+
+	p.HostBaseURL = b.server.URL
+	p.Token = bitbucketToken
+	r, err := NewBitbucketRemote(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+// error writes a bitbucket error response
+func (b *bitbucketStandIn) error(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"type": "error", "error": map[string]string{"message": message}})
+}
+
+// serveHTTP answers a request to the api
+func (b *bitbucketStandIn) serveHTTP(w http.ResponseWriter, r *http.Request) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.requests = append(b.requests, r.Method+" "+r.URL.RequestURI())
+
+	if r.Header.Get("Authorization") != "Bearer "+bitbucketToken {
+		b.error(w, http.StatusUnauthorized, "Access token expired")
+		return
+	}
+
+	segs := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segs) < 2 || segs[0] != "repositories" {
+		b.error(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	switch {
+	case len(segs) == 2 && r.Method == "GET":
+		b.list(w, r, segs[1])
+	case len(segs) == 3:
+		b.repo(w, r, segs[1]+"/"+segs[2])
+	case len(segs) == 4 && segs[3] == "src" && r.Method == "POST":
+		b.src(w, r, segs[1]+"/"+segs[2])
+	default:
+		b.error(w, http.StatusNotFound, "Resource not found")
+	}
+}
+
+// list answers a listing of a workspace, the most recently updated repositories first
+func (b *bitbucketStandIn) list(w http.ResponseWriter, r *http.Request, workspace string) {
+
+	query := r.URL.Query()
+	if query.Get("sort") != "-updated_on" {
+		b.error(w, http.StatusBadRequest, "Unsupported sort "+query.Get("sort"))
+		return
+	}
+	project := ""
+	if q := query.Get("q"); q != "" {
+		project = strings.Trim(strings.TrimPrefix(q, "project.key="), `"`)
+	}
+
+	repos := []*bitbucketRepo{}
+	for fullName, repo := range b.repos {
+		if strings.HasPrefix(fullName, workspace+"/") && (project == "" || b.projects[fullName] == project) {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].UpdatedOn.After(repos[j].UpdatedOn) })
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	pageLen, _ := strconv.Atoi(query.Get("pagelen"))
+	if page < 1 {
+		page = 1
+	}
+	if pageLen < 1 || pageLen > b.maxPageLen {
+		pageLen = b.maxPageLen
+	}
+
+	result := bitbucketPage{Values: []*bitbucketRepo{}}
+	start, end := (page-1)*pageLen, page*pageLen
+	if start < len(repos) {
+		if end > len(repos) {
+			end = len(repos)
+		}
+		result.Values = repos[start:end]
+	}
+	if end < len(repos) {
+		query.Set("page", fmt.Sprint(page+1))
+		result.Next = b.server.URL + r.URL.Path + "?" + query.Encode()
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// repo answers requests for a single repository
+func (b *bitbucketStandIn) repo(w http.ResponseWriter, r *http.Request, fullName string) {
+
+	repo := b.repos[fullName]
+
+	switch r.Method {
+	case "POST":
+		if repo != nil {
+			b.error(w, http.StatusBadRequest, "Repository with this Slug and Owner already exists.")
+			return
+		}
+		body := struct {
+			SCM       string `json:"scm"`
+			IsPrivate bool   `json:"is_private"`
+			Project   *struct {
+				Key string `json:"key"`
+			} `json:"project"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SCM != "git" {
+			b.error(w, http.StatusBadRequest, "Invalid repository")
+			return
+		}
+		repo = b.newRepo(fullName, body.IsPrivate)
+		if body.Project != nil {
+			b.projects[fullName] = body.Project.Key
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(repo)
+		return
+	}
+
+	if repo == nil {
+		b.error(w, http.StatusNotFound, fmt.Sprintf("Repository %s not found", fullName))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(repo)
+	case "PUT":
+		body := struct {
+			IsPrivate *bool `json:"is_private"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.IsPrivate != nil {
+			repo.IsPrivate = *body.IsPrivate
+		}
+		repo.UpdatedOn = b.now()
+		json.NewEncoder(w).Encode(repo)
+	case "DELETE":
+		delete(b.repos, fullName)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		b.error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// src commits the files of a form-encoded request
+func (b *bitbucketStandIn) src(w http.ResponseWriter, r *http.Request, fullName string) {
+
+	repo := b.repos[fullName]
+	if repo == nil {
+		b.error(w, http.StatusNotFound, fmt.Sprintf("Repository %s not found", fullName))
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		b.error(w, http.StatusBadRequest, "Unsupported content type "+r.Header.Get("Content-Type"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		b.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	b.readmes[fullName] = r.PostForm.Get("README.md")
+	b.messages[fullName] = r.PostForm.Get("message")
+	repo.MainBranch = &struct {
+		Name string `json:"name"`
+	}{Name: "main"}
+	repo.UpdatedOn = b.now()
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// newRepo adds an empty repository
+func (b *bitbucketStandIn) newRepo(fullName string, private bool) *bitbucketRepo {
+
+	repo := &bitbucketRepo{
+		Name:      fullName[strings.Index(fullName, "/")+1:],
+		FullName:  fullName,
+		IsPrivate: private,
+		CreatedOn: b.now(),
+	}
+	repo.UpdatedOn = repo.CreatedOn
+	repo.Links.HTML.Href = "https://bitbucket.org/" + fullName
+	repo.Links.Clone = []struct {
+		Name string `json:"name"`
+		Href string `json:"href"`
+	}{
+		{Name: "https", Href: "https://bitbucket.org/" + fullName + ".git"},
+		{Name: "ssh", Href: "git@bitbucket.org:" + fullName + ".git"},
+	}
+	b.repos[fullName] = repo
+
+	return repo
+}
+
+// now returns a time later than all times returned before
+func (b *bitbucketStandIn) now() time.Time {
+	b.clock = b.clock.Add(time.Minute)
+	return b.clock
+}
+
+func TestBitbucketCreateRepo(t *testing.T) {
+
+	b := newBitbucketStandIn(t)
+	r := b.remote(t, Provider{User: "alice", Project: "TOOLS"})
+	ctx := context.Background()
+
+	repo, err := r.CreateRepo(ctx, "tool", &CreateOptions{Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "alice/tool" || repo.Visibility != VisibilityPublic {
+		t.Errorf("Created %s with the visibility %s, want a public alice/tool", repo.FullName, repo.Visibility)
+	}
+	if repo.SSHURL != "git@bitbucket.org:alice/tool.git" || repo.HTTPURL != "https://bitbucket.org/alice/tool.git" {
+		t.Errorf("Created repository has the clone urls %s and %s", repo.SSHURL, repo.HTTPURL)
+	}
+	if b.readmes["alice/tool"] != "# tool\n" || b.messages["alice/tool"] == "" {
+		t.Errorf("README %q was committed with the message %q", b.readmes["alice/tool"], b.messages["alice/tool"])
+	}
+	if b.projects["alice/tool"] != "TOOLS" {
+		t.Errorf("Repository was created in the project %q, want TOOLS", b.projects["alice/tool"])
+	}
+
+	// Repositories are private by default
+	repo, err = r.CreateRepo(ctx, "team/private", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "team/private" || repo.Visibility != VisibilityPrivate {
+		t.Errorf("Created %s with the visibility %s, want a private team/private", repo.FullName, repo.Visibility)
+	}
+
+	_, err = r.CreateRepo(ctx, "tool", nil)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Creating an existing repository returned %v, want the bitbucket error message", err)
+	}
+	if _, err = r.CreateRepo(ctx, "internal", &CreateOptions{Visibility: VisibilityInternal}); err == nil {
+		t.Errorf("Creating an internal repository succeeded")
+	}
+}
+
+func TestBitbucketListRepos(t *testing.T) {
+
+	b := newBitbucketStandIn(t)
+	for i := 0; i < 8; i++ {
+		b.newRepo(fmt.Sprintf("alice/repo-%d", i), i%2 == 0)
+	}
+	b.newRepo("bob/other", false)
+	ctx := context.Background()
+	r := b.remote(t, Provider{User: "alice"})
+
+	repos, err := r.ListRepos(ctx, nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 8 {
+		t.Fatalf("Listed %d repositories, want 8", len(repos))
+	}
+	for i, repo := range repos {
+		if want := fmt.Sprintf("alice/repo-%d", 7-i); repo.FullName != want {
+			t.Errorf("Repository %d is %s, want %s", i, repo.FullName, want)
+		}
+	}
+	if n := len(b.requests); n != 3 {
+		t.Errorf("Listing took %d requests, want 3 pages: %s", n, b.requests)
+	}
+
+	// A limit stops paging early
+	b.requests = nil
+	repos, err = r.ListRepos(ctx, &ListOptions{Limit: 4}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 4 || len(b.requests) != 2 {
+		t.Errorf("Listed %d repositories with %d requests, want 4 with 2 requests", len(repos), len(b.requests))
+	}
+
+	// The owner selects another workspace
+	repos, err = r.ListRepos(ctx, &ListOptions{Owner: "bob"}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].FullName != "bob/other" {
+		t.Errorf("Listed %v for bob, want bob/other", repos)
+	}
+
+	// The configured project filters the listing
+	b.projects["alice/repo-3"] = "TOOLS"
+	repos, err = b.remote(t, Provider{User: "alice", Project: "TOOLS"}).ListRepos(ctx, nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].FullName != "alice/repo-3" {
+		t.Errorf("Listed %v for the project TOOLS, want alice/repo-3", repos)
+	}
+}
+
+func TestBitbucketDeleteRepo(t *testing.T) {
+
+	b := newBitbucketStandIn(t)
+	b.newRepo("alice/tool", true)
+	r := b.remote(t, Provider{User: "alice"})
+	ctx := context.Background()
+
+	if err := r.DeleteRepo(ctx, "tool"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.repos["alice/tool"]; ok {
+		t.Errorf("Repository was not deleted")
+	}
+
+	err := r.DeleteRepo(ctx, "tool")
+	if !isStatus(err, http.StatusNotFound) || !strings.Contains(err.Error(), "Repository alice/tool not found") {
+		t.Errorf("Deleting a missing repository returned %v, want a 404 with the bitbucket error message", err)
+	}
+}
+
+func TestBitbucketSetVisibility(t *testing.T) {
+
+	b := newBitbucketStandIn(t)
+	b.newRepo("alice/tool", true)
+	r := b.remote(t, Provider{User: "alice"})
+
+	if err := r.SetVisibility(context.Background(), "tool", VisibilityPublic); err != nil {
+		t.Fatal(err)
+	}
+	if b.repos["alice/tool"].IsPrivate {
+		t.Errorf("Repository is still private")
+	}
+}
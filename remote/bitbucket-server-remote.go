@@ -0,0 +1,338 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// bitbucketServerPerPage is the page size for listings of the bitbucket server api
+const bitbucketServerPerPage = 100
+
+func init() {
+	Register("bitbucket-server", func(p Provider) (Remote, error) { return NewBitbucketServerRemote(p) }, Capabilities{
+		Visibilities: []Visibility{VisibilityPublic, VisibilityPrivate},
+		Protocols:    []string{"ssh", "http"},
+		ListOrder:    ListOrderName,
+	})
+}
+
+// BitbucketServerRemote implements Remote for Bitbucket Server and Data Center.
+// Repositories belong to a project, which is addressed by its key.
+type BitbucketServerRemote struct {
+	Provider   Provider
+	HTTPClient *http.Client
+
+	rest *restClient
+}
+
+// bitbucketServerRepo is a repository of the Bitbucket Server 1.0 api
+type bitbucketServerRepo struct {
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	Public  bool   `json:"public"`
+	Project struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Links struct {
+		Self []struct {
+			Href string `json:"href"`
+		} `json:"self"`
+		Clone []struct {
+			Name string `json:"name"`
+			Href string `json:"href"`
+		} `json:"clone"`
+	} `json:"links"`
+}
+
+// bitbucketServerPage is a page of a bitbucket server listing
+type bitbucketServerPage struct {
+	Values        []*bitbucketServerRepo `json:"values"`
+	IsLastPage    bool                   `json:"isLastPage"`
+	NextPageStart int                    `json:"nextPageStart"`
+}
+
+// project returns the project key and the slug of a repository given as "KEY/slug" or "slug"
+func (b *BitbucketServerRemote) project(name string) (string, string) {
+
+	key, slug := splitName(name)
+	if key == "" {
+		key = b.Provider.Project
+	}
+
+	return key, slug
+}
+
+// path returns the api path of the repository name
+func (b *BitbucketServerRemote) path(name string) string {
+	key, slug := b.project(name)
+	return fmt.Sprintf("projects/%s/repos/%s", url.PathEscape(key), url.PathEscape(slug))
+}
+
+// public maps visibility to the public flag of a repository, bitbucket server has no internal repositories
+func (b *BitbucketServerRemote) public(visibility Visibility) (bool, error) {
+
+	switch visibility {
+	case VisibilityPublic:
+		return true, nil
+	case VisibilityPrivate:
+		return false, nil
+	}
+
+	return false, unsupportedVisibility(b.Provider.Type, visibility)
+}
+
+// CreateRepo creates a remote repository in the project
+func (b *BitbucketServerRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	visibility, err := opts.visibility(b.Provider)
+	if err != nil {
+		return nil, err
+	}
+	public, err := b.public(visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create repo
+	key, repoName := b.project(name)
+	body := map[string]interface{}{"name": repoName, "scmId": "git", "public": public}
+	repo := new(bitbucketServerRepo)
+	err = b.rest.do(ctx, "POST", fmt.Sprintf("projects/%s/repos", url.PathEscape(key)), body, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a basic README, files are uploaded as multipart form
+	form := new(bytes.Buffer)
+	w := multipart.NewWriter(form)
+	w.WriteField("content", fmt.Sprintf("# %s\n", repoName))
+	w.WriteField("message", "Added a README")
+	w.WriteField("branch", "master")
+	w.Close()
+	err = b.rest.send(ctx, "PUT", b.path(key+"/"+repo.Slug)+"/browse/README.md", w.FormDataContentType(), form, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return bitbucketServerRepository(repo), nil
+}
+
+// CloneRepo clones the remote repository
+func (b *BitbucketServerRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	var endpoint *transport.Endpoint
+
+	repo := new(bitbucketServerRepo)
+	err := b.rest.do(ctx, "GET", b.path(name), nil, repo)
+	if err != nil {
+		return err
+	}
+
+	urls := bitbucketServerRepository(repo)
+
+	// Define a git endpoint
+	switch b.Provider.CloneProtocol {
+	case "ssh", "":
+		endpoint, err = transport.NewEndpoint(urls.SSHURL)
+	case "http":
+		endpoint, err = transport.NewEndpoint(urls.HTTPURL)
+		if err == nil {
+			// Personal access tokens are used like passwords
+			endpoint.User, endpoint.Password = b.Provider.User, b.Provider.Password
+			if b.Provider.Token != "" {
+				endpoint.Password = b.Provider.Token
+			}
+		}
+	default:
+		err = fmt.Errorf("Unknown clone protocol %s", b.Provider.CloneProtocol)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := sshAuth(b.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository, the server removes it in the background
+func (b *BitbucketServerRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	err := b.rest.do(ctx, "DELETE", b.path(name), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetVisibility changes the visibility of a (remote) repository
+func (b *BitbucketServerRemote) SetVisibility(ctx context.Context, name string, visibility Visibility) error {
+
+	public, err := b.public(visibility)
+	if err != nil {
+		return err
+	}
+
+	err = b.rest.do(ctx, "PUT", b.path(name), map[string]bool{"public": public}, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos lists the repos of the project sorted by name
+func (b *BitbucketServerRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	key := opts.owner()
+	if key == "" {
+		key = b.Provider.Project
+	}
+
+	// The api pages by the index of the first repository, which the previous page returns,
+	// and lists in no defined order.
+	start := 0
+	return NewRepoIterator(ctx, opts, bitbucketServerPerPage, sortByName(bitbucketServerPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		result := new(bitbucketServerPage)
+		path := fmt.Sprintf("projects/%s/repos?start=%d&limit=%d", url.PathEscape(key), start, perPage)
+		err := b.rest.do(ctx, "GET", path, nil, result)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		repos := make([]*Repository, 0, len(result.Values))
+		for _, r := range result.Values {
+			repos = append(repos, bitbucketServerRepository(r))
+		}
+
+		if result.IsLastPage {
+			return repos, 0, nil
+		}
+
+		start = result.NextPageStart
+
+		return repos, page + 1, nil
+	}))
+}
+
+// bitbucketServerRepository converts a bitbucket server repository into a Repository
+func bitbucketServerRepository(r *bitbucketServerRepo) *Repository {
+
+	visibility := VisibilityPrivate
+	if r.Public {
+		visibility = VisibilityPublic
+	}
+
+	repo := &Repository{
+		Name:       r.Slug,
+		FullName:   r.Project.Key + "/" + r.Slug,
+		Visibility: visibility,
+	}
+	if len(r.Links.Self) > 0 {
+		repo.WebURL = r.Links.Self[0].Href
+	}
+	for _, c := range r.Links.Clone {
+		switch c.Name {
+		case "ssh":
+			repo.SSHURL = c.Href
+		case "http":
+			repo.HTTPURL = c.Href
+		}
+	}
+
+	return repo
+}
+
+// bitbucketServerMessage extracts the messages of a bitbucket server error response
+func bitbucketServerMessage(body []byte) string {
+
+	e := struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	if json.Unmarshal(body, &e) != nil {
+		return ""
+	}
+
+	messages := make([]string, 0, len(e.Errors))
+	for _, m := range e.Errors {
+		messages = append(messages, m.Message)
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+// NewBitbucketServerRemote creates a new Remote object and returns it.
+// Personal access tokens are used as bearer tokens, otherwise the user authenticates with the password.
+func NewBitbucketServerRemote(p Provider) (*BitbucketServerRemote, error) {
+
+	if p.HostBaseURL == "" {
+		return nil, fmt.Errorf("No host_base_url configured for bitbucket server")
+	}
+
+	remote := new(BitbucketServerRemote)
+
+	if p.Type == "" {
+		p.Type = "bitbucket-server"
+	}
+	// Without a project the personal project of the user is used
+	if p.Project == "" {
+		p.Project = p.Owner
+	}
+	if p.Project == "" && p.User != "" {
+		p.Project = "~" + p.User
+	}
+
+	// The api is below /rest/api/1.0 of the host, unless the url points to it already
+	baseURL := strings.TrimSuffix(p.HostBaseURL, "/")
+	if !strings.Contains(baseURL, "/rest/") {
+		baseURL += "/rest/api/1.0"
+	}
+
+	remote.Provider = p
+	remote.HTTPClient = new(http.Client)
+	remote.rest = &restClient{
+		baseURL:    baseURL,
+		httpClient: remote.HTTPClient,
+		message:    bitbucketServerMessage,
+		authorize: func(req *http.Request) {
+			if p.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+p.Token)
+			} else if p.User != "" {
+				req.SetBasicAuth(p.User, p.Password)
+			}
+		},
+	}
+
+	return remote, nil
+}
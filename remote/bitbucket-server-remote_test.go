@@ -0,0 +1,91 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestBitbucketServerListRepos(t *testing.T) {
+
+	// The server pages by start index in steps of 3, whatever the limit is
+	const pageLen = 3
+	var starts []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path != "/rest/api/1.0/projects/TOOLS/repos" {
+			http.NotFound(w, r)
+			return
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		starts = append(starts, start)
+
+		page := bitbucketServerPage{Values: []*bitbucketServerRepo{}}
+		for i := start; i < start+pageLen && i < 8; i++ {
+			// The api lists in no defined order, the remote sorts by name
+			repo := &bitbucketServerRepo{Slug: fmt.Sprintf("repo-%d", 7-i)}
+			repo.Project.Key = "TOOLS"
+			page.Values = append(page.Values, repo)
+		}
+		page.IsLastPage = start+pageLen >= 8
+		if !page.IsLastPage {
+			page.NextPageStart = start + pageLen
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	r, err := NewBitbucketServerRemote(Provider{HostBaseURL: server.URL, Project: "TOOLS", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := r.ListRepos(context.Background(), nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 8 {
+		t.Fatalf("Listed %d repositories, want 8", len(repos))
+	}
+	for i, repo := range repos {
+		if want := fmt.Sprintf("TOOLS/repo-%d", i); repo.FullName != want {
+			t.Errorf("Repository %d is %s, want %s", i, repo.FullName, want)
+		}
+	}
+	if fmt.Sprint(starts) != "[0 3 6]" {
+		t.Errorf("Pages started at %v, want [0 3 6]", starts)
+	}
+
+	// The sorted listing is fetched completely, even with a limit
+	starts = nil
+	repos, err = r.ListRepos(context.Background(), &ListOptions{Limit: 5}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 5 || repos[4].FullName != "TOOLS/repo-4" {
+		t.Errorf("Listed %d repositories with a limit of 5", len(repos))
+	}
+	if fmt.Sprint(starts) != "[0 3 6]" {
+		t.Errorf("Pages started at %v, want [0 3 6]", starts)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Provider contains all the necessary config settings of a remote on a git provider.
+// Type selects the provider implementation, it defaults to the name of the remote in the config file.
+// Owner is the user or organisation owning the repositories, it defaults to User.
+// Visibility is the default visibility of new repositories.
+// Project is the project key of providers grouping repositories in projects, e.g. Bitbucket.
+// Parent is the project new Gerrit projects inherit their permissions from.
+// SSHKeyFile is a private key without passphrase for ssh clones, the ssh-agent is used if it is empty.
+// GroupName is the full path of a GitLab namespace, e.g. platform/backend/services.
+type Provider struct {
+	Type          string     `json:"type" yaml:"type"`
+	Token         string     `json:"token" yaml:"token"`
+	TokenName     string     `json:"token_name" yaml:"token_name"`
+	HostBaseURL   string     `json:"host_base_url" yaml:"host_base_url"`
+	UploadURL     string     `json:"upload_url,omitempty" yaml:"upload_url,omitempty"`
+	User          string     `json:"user" yaml:"user"`
+	Password      string     `json:"password" yaml:"password"`
+	GroupName     string     `json:"group_name" yaml:"group_name"`
+	Owner         string     `json:"owner" yaml:"owner"`
+	Project       string     `json:"project,omitempty" yaml:"project,omitempty"`
+	Parent        string     `json:"parent,omitempty" yaml:"parent,omitempty"`
+	CloneProtocol string     `json:"clone_protocol" yaml:"clone_protocol"`
+	SSHKeyFile    string     `json:"ssh_key_file,omitempty" yaml:"ssh_key_file,omitempty"`
+	Visibility    Visibility `json:"visibility,omitempty" yaml:"visibility,omitempty"`
+}
+
+// Masked returns a copy of the provider settings with all credentials masked
+func (p Provider) Masked() Provider {
+	if p.Token != "" {
+		p.Token = "********"
+	}
+	if p.Password != "" {
+		p.Password = "********"
+	}
+	return p
+}
+
+// Config contains all necessary config settings.
+// Provider maps the names of the configured remotes to their settings.
+type Config struct {
+	Provider map[string]Provider `json:"provider"`
+}
+
+func (c *Config) readFile(fname string) error {
+
+	// Read raw config file -> []byte
+	rawConfFile, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return fmt.Errorf("Could not read config file %s: %s", fname, err)
+	}
+
+	// Unmarshall json from rawConfFile into the provider settings
+	err = json.Unmarshal(rawConfFile, &c.Provider)
+	if err != nil {
+		return fmt.Errorf("Could not unmarshal json from %s: %s", fname, err)
+	}
+
+	return nil
+}
+
+// NewConfig reads the config file fname and returns a new config object
+func NewConfig(fname string) (*Config, error) {
+
+	c := new(Config)
+
+	// Check if we have a config file
+	if _, err := os.Stat(fname); err != nil {
+		return &Config{}, fmt.Errorf("Could not read config file %s: %s", fname, err)
+	}
+
+	err := c.readFile(fname)
+	if err != nil {
+
+		return &Config{}, err
+	}
+
+	return c, nil
+}
+
+// DefaultConfigFile returns the location of the config file in the users home directory
+func DefaultConfigFile() string {
+	return fmt.Sprintf("%s/%s", os.Getenv("HOME"), ".gitrc.json")
+}
+
+// Names returns the sorted names of all configured remotes
+func (c *Config) Names() []string {
+
+	names := make([]string, 0, len(c.Provider))
+	for name := range c.Provider {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Type returns the provider type of the configured remote name
+func (c *Config) Type(name string) (string, error) {
+
+	p, ok := c.Provider[name]
+	if !ok {
+		return "", fmt.Errorf("Remote %s is not configured, configured remotes are: %s", name, c.Names())
+	}
+	if p.Type != "" {
+		return p.Type, nil
+	}
+
+	// Remotes named like a provider type don't need a type, e.g. "github"
+	return name, nil
+}
+
+// Remote creates the configured remote name
+func (c *Config) Remote(name string) (Remote, error) {
+
+	typ, err := c.Type(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := c.Provider[name]
+	p.Type = typ
+
+	r, err := New(typ, p)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create remote %s: %s", name, err)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,94 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/wpueschel/gitrc/remote"
+	"github.com/wpueschel/gitrc/remote/fakeforge"
+	"github.com/wpueschel/gitrc/remote/remotetest"
+)
+
+// capabilities returns the registered capabilities of the provider typ
+func capabilities(t *testing.T, typ string) remote.Capabilities {
+
+	caps, ok := remote.ProviderCapabilities(typ)
+	if !ok {
+		t.Fatalf("Provider %s is not registered", typ)
+	}
+
+	return caps
+}
+
+// forgeFactory returns a factory of remotes on a new fake forge of alice.
+// With an org, the remotes create their repositories in it, which allows internal repositories on GitHub.
+func forgeFactory(flavour, org string) remotetest.Factory {
+
+	return func(t *testing.T) remote.Remote {
+
+		s := fakeforge.New(flavour, "alice")
+		t.Cleanup(s.Close)
+
+		p := s.Provider()
+		if org != "" {
+			s.AddOrg(org)
+			p.Owner = org
+			p.GroupName = org
+		}
+
+		r, err := remote.New(flavour, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	}
+}
+
+func TestConformanceGithub(t *testing.T) {
+	remotetest.Run(t, capabilities(t, "github"), forgeFactory(fakeforge.GitHub, "acme"))
+}
+
+func TestConformanceGitlab(t *testing.T) {
+	remotetest.Run(t, capabilities(t, "gitlab"), forgeFactory(fakeforge.GitLab, "acme"))
+}
+
+func TestConformanceGitea(t *testing.T) {
+	remotetest.Run(t, capabilities(t, "gitea"), forgeFactory(fakeforge.Gitea, ""))
+}
+
+func TestConformanceLocal(t *testing.T) {
+
+	remotetest.Run(t, capabilities(t, "local"), func(t *testing.T) remote.Remote {
+
+		dir, err := ioutil.TempDir("", "gitrc-local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		r, err := remote.New("local", remote.Provider{Type: "local", HostBaseURL: dir, User: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	})
+}
@@ -0,0 +1,302 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fakeforge
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/wpueschel/gitrc/remote"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+// Services of the smart HTTP protocol
+const (
+	uploadPack  = "git-upload-pack"
+	receivePack = "git-receive-pack"
+)
+
+// isGitRequest checks if a request is sent to the smart HTTP endpoint of a repository
+func isGitRequest(r *http.Request) bool {
+	return strings.Contains(r.URL.Path, ".git/")
+}
+
+// repoLoader loads the storage of a single repository for the git server of go-git
+type repoLoader struct {
+	repo *Repo
+}
+
+// Load returns the storage of the repository for any endpoint
+func (l repoLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	return l.repo.Storage, nil
+}
+
+// serveGit serves the smart HTTP protocol for the repository of the request.
+// Public repositories can be cloned anonymously, other clones and all pushes need the token as password.
+func (s *Server) serveGit(w http.ResponseWriter, r *http.Request) {
+
+	i := strings.Index(r.URL.Path, ".git/")
+	fullName := strings.Trim(r.URL.Path[:i], "/")
+	action := r.URL.Path[i+len(".git/"):]
+
+	service := action
+	if action == "info/refs" && r.Method == "GET" {
+		service = r.URL.Query().Get("service")
+	} else if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if service != uploadPack && service != receivePack {
+		http.Error(w, "Unknown service "+service, http.StatusForbidden)
+		return
+	}
+
+	repo := s.repos[strings.ToLower(fullName)]
+	if repo == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	if (service == receivePack || repo.Visibility != remote.VisibilityPublic) && !s.gitAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="fakeforge"`)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if service == receivePack && repo.Archived {
+		http.Error(w, "The repository is archived", http.StatusForbidden)
+		return
+	}
+
+	var err error
+	if action == "info/refs" {
+		err = advertise(w, repo, service)
+	} else if service == uploadPack {
+		err = upload(w, r, repo)
+	} else {
+		err = s.receive(w, r, repo)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// gitAuthorized checks the basic authentication of a git request, any user with the token as password is accepted
+func (s *Server) gitAuthorized(r *http.Request) bool {
+
+	if s.Token == "" {
+		return true
+	}
+	_, password, ok := r.BasicAuth()
+
+	return ok && password == s.Token
+}
+
+// advertise writes the references of the repository for service
+func advertise(w http.ResponseWriter, repo *Repo, service string) error {
+
+	ep, _ := transport.NewEndpoint("/")
+	srv := server.NewServer(repoLoader{repo})
+
+	var ar *packp.AdvRefs
+	var err error
+	if service == uploadPack {
+		var sess transport.UploadPackSession
+		sess, err = srv.NewUploadPackSession(ep, nil)
+		if err == nil {
+			ar, err = sess.AdvertisedReferences()
+		}
+	} else {
+		var sess transport.ReceivePackSession
+		sess, err = srv.NewReceivePackSession(ep, nil)
+		if err == nil {
+			ar, err = sess.AdvertisedReferences()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	ar.Prefix = [][]byte{[]byte("# service=" + service), pktline.Flush}
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	return ar.Encode(w)
+}
+
+// upload answers an upload-pack request with a packfile
+func upload(w http.ResponseWriter, r *http.Request, repo *Repo) error {
+
+	req := packp.NewUploadPackRequest()
+	err := req.UploadRequest.Decode(r.Body)
+	if err != nil {
+		return err
+	}
+
+	// The haves follow the wants until done
+	scanner := pktline.NewScanner(r.Body)
+	for scanner.Scan() {
+		line := string(bytes.TrimSpace(scanner.Bytes()))
+		if line == "done" {
+			break
+		}
+		if strings.HasPrefix(line, "have ") {
+			req.Haves = append(req.Haves, plumbing.NewHash(strings.TrimPrefix(line, "have ")))
+		}
+	}
+
+	ep, _ := transport.NewEndpoint("/")
+	sess, err := server.NewServer(repoLoader{repo}).NewUploadPackSession(ep, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := sess.UploadPack(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+
+	return resp.Encode(w)
+}
+
+// receive applies a receive-pack request and reports its status
+func (s *Server) receive(w http.ResponseWriter, r *http.Request, repo *Repo) error {
+
+	req := packp.NewReferenceUpdateRequest()
+	err := req.Decode(r.Body)
+	if err != nil {
+		return err
+	}
+
+	ep, _ := transport.NewEndpoint("/")
+	sess, err := server.NewServer(repoLoader{repo}).NewReceivePackSession(ep, nil)
+	if err != nil {
+		return err
+	}
+	status, err := sess.ReceivePack(r.Context(), req)
+	if status == nil {
+		return err
+	}
+	repo.Updated = s.now()
+
+	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+
+	return status.Encode(w)
+}
+
+// commitFile commits the file path with content to the default branch of a repository.
+// Only files in the root directory are supported, an existing file is replaced.
+func (s *Server) commitFile(repo *Repo, path string, content []byte, message string) error {
+
+	if path == "" || strings.Contains(path, "/") {
+		return fmt.Errorf("Unsupported path %s", path)
+	}
+
+	st := repo.Storage
+	branch := plumbing.Master
+	if head, err := st.Reference(plumbing.HEAD); err == nil && head.Type() == plumbing.SymbolicReference {
+		branch = head.Target()
+	}
+
+	// Start with the files of the last commit
+	entries := []object.TreeEntry{}
+	var parents []plumbing.Hash
+	if ref, err := st.Reference(branch); err == nil {
+		commit, err := object.GetCommit(st, ref.Hash())
+		if err != nil {
+			return err
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return err
+		}
+		for _, e := range tree.Entries {
+			if e.Name != path {
+				entries = append(entries, e)
+			}
+		}
+		parents = []plumbing.Hash{commit.Hash}
+	}
+
+	blob := st.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	wr, err := blob.Writer()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(wr, bytes.NewReader(content))
+	wr.Close()
+	if err != nil {
+		return err
+	}
+	blobHash, err := st.SetEncodedObject(blob)
+	if err != nil {
+		return err
+	}
+
+	entries = append(entries, object.TreeEntry{Name: path, Mode: filemode.Regular, Hash: blobHash})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	treeHash, err := store(st, &object.Tree{Entries: entries})
+	if err != nil {
+		return err
+	}
+
+	when := s.now()
+	sig := object.Signature{Name: s.User, Email: s.User + "@fakeforge", When: when}
+	commitHash, err := store(st, &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	})
+	if err != nil {
+		return err
+	}
+
+	repo.Updated = when
+
+	return st.SetReference(plumbing.NewHashReference(branch, commitHash))
+}
+
+// store encodes a git object into the storage
+func store(st storage.Storer, o interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+
+	obj := st.NewEncodedObject()
+	err := o.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return st.SetEncodedObject(obj)
+}
@@ -0,0 +1,326 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fakeforge
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wpueschel/gitrc/remote"
+)
+
+// giteaPrefix is the path of the Gitea api
+const giteaPrefix = "/api/v1"
+
+// giteaVersion is the version reported by the version endpoint
+const giteaVersion = "1.21.0"
+
+// giteaUser is a user or an organisation in the Gitea api
+type giteaUser struct {
+	ID       int    `json:"id"`
+	Login    string `json:"login"`
+	UserName string `json:"username"`
+	FullName string `json:"full_name"`
+}
+
+// giteaRepo is a repository in the Gitea api
+type giteaRepo struct {
+	ID            int        `json:"id"`
+	Owner         giteaUser  `json:"owner"`
+	Name          string     `json:"name"`
+	FullName      string     `json:"full_name"`
+	Empty         bool       `json:"empty"`
+	Private       bool       `json:"private"`
+	Fork          bool       `json:"fork"`
+	Parent        *giteaRepo `json:"parent"`
+	Size          int        `json:"size"`
+	HTMLURL       string     `json:"html_url"`
+	SSHURL        string     `json:"ssh_url"`
+	CloneURL      string     `json:"clone_url"`
+	DefaultBranch string     `json:"default_branch"`
+	Archived      bool       `json:"archived"`
+	Created       time.Time  `json:"created_at"`
+	Updated       time.Time  `json:"updated_at"`
+}
+
+// giteaRepoRequest is the body of create, edit and fork requests
+type giteaRepoRequest struct {
+	Name         *string `json:"name"`
+	Private      *bool   `json:"private"`
+	Archived     *bool   `json:"archived"`
+	AutoInit     bool    `json:"auto_init"`
+	Organization *string `json:"organization"`
+}
+
+// serveGitea answers a request to the Gitea api.
+// The server is no Forgejo, so the Forgejo version endpoint is not found.
+func (s *Server) serveGitea(w http.ResponseWriter, r *http.Request) {
+
+	segs, ok := segments(r, giteaPrefix)
+	if !ok {
+		s.apiError(w, http.StatusNotFound, "")
+		return
+	}
+
+	if _, ok := match(segs, "version"); ok && r.Method == "GET" {
+		writeJSON(w, http.StatusOK, map[string]string{"version": giteaVersion})
+		return
+	}
+	if _, ok := match(segs, "user"); ok && r.Method == "GET" {
+		writeJSON(w, http.StatusOK, giteaOwner(s.namespaces[strings.ToLower(s.User)]))
+		return
+	}
+	if v, ok := match(segs, "users/*"); ok && r.Method == "GET" {
+		ns := s.namespaces[strings.ToLower(v[0])]
+		if ns == nil || ns.Org {
+			s.apiError(w, http.StatusNotFound, "")
+			return
+		}
+		writeJSON(w, http.StatusOK, giteaOwner(ns))
+		return
+	}
+	if v, ok := match(segs, "orgs/*"); ok && r.Method == "GET" {
+		ns := s.namespaces[strings.ToLower(v[0])]
+		if ns == nil || !ns.Org {
+			s.apiError(w, http.StatusNotFound, "")
+			return
+		}
+		writeJSON(w, http.StatusOK, giteaOwner(ns))
+		return
+	}
+
+	// Listings
+	if _, ok := match(segs, "user/repos"); ok && r.Method == "GET" {
+		s.giteaList(w, r, s.User, false)
+		return
+	}
+	if v, ok := match(segs, "users/*/repos"); ok && r.Method == "GET" {
+		s.giteaList(w, r, v[0], false)
+		return
+	}
+	if v, ok := match(segs, "orgs/*/repos"); ok && r.Method == "GET" {
+		s.giteaList(w, r, v[0], true)
+		return
+	}
+
+	// Creation
+	if _, ok := match(segs, "user/repos"); ok && r.Method == "POST" {
+		s.giteaCreate(w, r, s.User, false)
+		return
+	}
+	if v, ok := match(segs, "org/*/repos"); ok && r.Method == "POST" {
+		s.giteaCreate(w, r, v[0], true)
+		return
+	}
+
+	// Single repositories
+	var repo *Repo
+	if len(segs) >= 3 && segs[0] == "repos" {
+		repo = s.repo(segs[1], segs[2])
+	}
+	if repo == nil || !s.visible(repo) {
+		s.apiError(w, http.StatusNotFound, "")
+		return
+	}
+
+	if _, ok := match(segs, "repos/*/*"); ok {
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, s.giteaRepo(repo))
+		case "PATCH":
+			s.giteaEdit(w, r, repo)
+		case "DELETE":
+			delete(s.repos, strings.ToLower(repo.FullName()))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			s.apiError(w, http.StatusNotFound, "")
+		}
+		return
+	}
+	if _, ok := match(segs, "repos/*/*/forks"); ok && r.Method == "POST" {
+		s.giteaFork(w, r, repo)
+		return
+	}
+
+	s.apiError(w, http.StatusNotFound, "")
+}
+
+// giteaOwner converts a user or an organisation
+func giteaOwner(ns *namespace) giteaUser {
+	return giteaUser{ID: ns.ID, Login: ns.Path, UserName: ns.Path}
+}
+
+// giteaRepo converts a repository, gitea has no internal repositories
+func (s *Server) giteaRepo(repo *Repo) *giteaRepo {
+
+	r := &giteaRepo{
+		ID:            repo.ID,
+		Owner:         giteaOwner(s.namespaces[strings.ToLower(repo.Owner)]),
+		Name:          repo.Name,
+		FullName:      repo.FullName(),
+		Empty:         len(repo.Storage.Commits) == 0,
+		Private:       repo.Visibility != remote.VisibilityPublic,
+		Fork:          repo.Parent != "",
+		Size:          size(repo),
+		HTMLURL:       s.URL + "/" + repo.FullName(),
+		SSHURL:        s.sshURL(repo),
+		CloneURL:      s.cloneURL(repo),
+		DefaultBranch: defaultBranch(repo),
+		Archived:      repo.Archived,
+		Created:       repo.Created,
+		Updated:       repo.Updated,
+	}
+	if parent := s.repos[strings.ToLower(repo.Parent)]; parent != nil {
+		r.Parent = s.giteaRepo(parent)
+	}
+
+	return r
+}
+
+// giteaCreate creates a repository of the user or the organisation owner.
+// With auto_init the repository is initialised with a README.
+func (s *Server) giteaCreate(w http.ResponseWriter, r *http.Request, owner string, org bool) {
+
+	ns := s.namespaces[strings.ToLower(owner)]
+	if ns == nil || ns.Org != org {
+		s.apiError(w, http.StatusNotFound, "")
+		return
+	}
+
+	req := new(giteaRepoRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if req.Name == nil || *req.Name == "" {
+		s.apiError(w, http.StatusUnprocessableEntity, "[Name]: Required")
+		return
+	}
+	if s.repo(ns.Path, *req.Name) != nil {
+		s.apiError(w, http.StatusConflict, "The repository with the same name already exists.")
+		return
+	}
+
+	visibility := remote.VisibilityPublic
+	if req.Private != nil && *req.Private {
+		visibility = remote.VisibilityPrivate
+	}
+
+	repo := s.newRepo(ns, *req.Name, visibility)
+	if req.AutoInit {
+		s.commitFile(repo, "README.md", []byte("# "+repo.Name+"\n"), "Initial commit")
+	}
+
+	writeJSON(w, http.StatusCreated, s.giteaRepo(repo))
+}
+
+// giteaEdit changes the name, the visibility or the archived flag of a repository
+func (s *Server) giteaEdit(w http.ResponseWriter, r *http.Request, repo *Repo) {
+
+	req := new(giteaRepoRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if req.Name != nil && *req.Name != repo.Name {
+		if *req.Name == "" {
+			s.apiError(w, http.StatusUnprocessableEntity, "[Name]: Required")
+			return
+		}
+		if existing := s.repo(repo.Owner, *req.Name); existing != nil && existing != repo {
+			s.apiError(w, http.StatusUnprocessableEntity, "repo name is already taken")
+			return
+		}
+		s.renameRepo(repo, *req.Name)
+	}
+	if req.Private != nil {
+		repo.Visibility = remote.VisibilityPublic
+		if *req.Private {
+			repo.Visibility = remote.VisibilityPrivate
+		}
+	}
+	if req.Archived != nil {
+		repo.Archived = *req.Archived
+	}
+	repo.Updated = s.now()
+
+	writeJSON(w, http.StatusOK, s.giteaRepo(repo))
+}
+
+// giteaFork forks a repository to the user or into an organisation
+func (s *Server) giteaFork(w http.ResponseWriter, r *http.Request, repo *Repo) {
+
+	req := new(giteaRepoRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	ns := s.namespaces[strings.ToLower(s.User)]
+	if req.Organization != nil && *req.Organization != "" {
+		ns = s.namespaces[strings.ToLower(*req.Organization)]
+		if ns == nil || !ns.Org {
+			s.apiError(w, http.StatusUnprocessableEntity, "organization does not exist")
+			return
+		}
+	}
+	if s.repo(ns.Path, repo.Name) != nil {
+		s.apiError(w, http.StatusConflict, "The repository with the same name already exists.")
+		return
+	}
+
+	fork := s.forkRepo(repo, ns, repo.Name)
+
+	writeJSON(w, http.StatusAccepted, s.giteaRepo(fork))
+}
+
+// giteaList lists the repositories of a user or an organisation in the order of their creation.
+// The repositories of the user include those of all organisations.
+func (s *Server) giteaList(w http.ResponseWriter, r *http.Request, owner string, org bool) {
+
+	ns := s.namespaces[strings.ToLower(owner)]
+	if ns == nil || ns.Org != org {
+		s.apiError(w, http.StatusNotFound, "")
+		return
+	}
+
+	owners := []string{ns.Path}
+	if strings.HasSuffix(r.URL.Path, giteaPrefix+"/user/repos") {
+		for _, o := range s.namespaces {
+			if o.Org {
+				owners = append(owners, o.Path)
+			}
+		}
+	}
+
+	repos := []*Repo{}
+	for _, repo := range s.ownedBy(owners...) {
+		if s.visible(repo) {
+			repos = append(repos, repo)
+		}
+	}
+
+	start, end := s.paginate(w, r, len(repos))
+	page := make([]*giteaRepo, 0, end-start)
+	for _, repo := range repos[start:end] {
+		page = append(page, s.giteaRepo(repo))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
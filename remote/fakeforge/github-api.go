@@ -0,0 +1,462 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fakeforge
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wpueschel/gitrc/remote"
+)
+
+// githubPrefix is the path of the api of GitHub Enterprise Server, which gitrc uses for all hosts but github.com
+const githubPrefix = "/api/v3"
+
+// githubVersion is the GitHub Enterprise Server version reported by the meta endpoint
+const githubVersion = "3.0.0"
+
+// githubOwner is the owner of a repository in the GitHub api
+type githubOwner struct {
+	Login string `json:"login"`
+	ID    int    `json:"id"`
+	Type  string `json:"type"`
+}
+
+// githubRepo is a repository in the GitHub api
+type githubRepo struct {
+	ID            int         `json:"id"`
+	Name          string      `json:"name"`
+	FullName      string      `json:"full_name"`
+	Owner         githubOwner `json:"owner"`
+	Private       bool        `json:"private"`
+	Visibility    string      `json:"visibility"`
+	Fork          bool        `json:"fork"`
+	Parent        *githubRepo `json:"parent,omitempty"`
+	HTMLURL       string      `json:"html_url"`
+	CloneURL      string      `json:"clone_url"`
+	SSHURL        string      `json:"ssh_url"`
+	DefaultBranch string      `json:"default_branch,omitempty"`
+	Archived      bool        `json:"archived"`
+	Size          int         `json:"size"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+	PushedAt      time.Time   `json:"pushed_at"`
+}
+
+// githubRepoRequest is the body of create and edit requests
+type githubRepoRequest struct {
+	Name       *string `json:"name"`
+	Private    *bool   `json:"private"`
+	Visibility *string `json:"visibility"`
+	Archived   *bool   `json:"archived"`
+	AutoInit   bool    `json:"auto_init"`
+}
+
+// githubFileRequest is the body of a request creating a file
+type githubFileRequest struct {
+	Message string `json:"message"`
+	Content []byte `json:"content"`
+	SHA     string `json:"sha"`
+}
+
+// serveGitHub answers a request to the GitHub api
+func (s *Server) serveGitHub(w http.ResponseWriter, r *http.Request) {
+
+	segs, ok := segments(r, githubPrefix)
+	if !ok {
+		s.apiError(w, http.StatusNotFound, "")
+		return
+	}
+
+	if _, ok := match(segs, "meta"); ok && r.Method == "GET" {
+		w.Header().Set("X-GitHub-Enterprise-Version", githubVersion)
+		writeJSON(w, http.StatusOK, map[string]string{"installed_version": githubVersion})
+		return
+	}
+	if _, ok := match(segs, "user"); ok && r.Method == "GET" {
+		writeJSON(w, http.StatusOK, s.githubOwner(s.namespaces[strings.ToLower(s.User)]))
+		return
+	}
+	if v, ok := match(segs, "users/*"); ok && r.Method == "GET" {
+		ns := s.namespaces[strings.ToLower(v[0])]
+		if ns == nil {
+			s.apiError(w, http.StatusNotFound, "")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.githubOwner(ns))
+		return
+	}
+
+	// Listings
+	if _, ok := match(segs, "user/repos"); ok && r.Method == "GET" {
+		s.githubList(w, r, s.User)
+		return
+	}
+	if v, ok := match(segs, "users/*/repos"); ok && r.Method == "GET" {
+		s.githubList(w, r, v[0])
+		return
+	}
+	if v, ok := match(segs, "orgs/*/repos"); ok && r.Method == "GET" {
+		s.githubList(w, r, v[0])
+		return
+	}
+
+	// Creation
+	if _, ok := match(segs, "user/repos"); ok && r.Method == "POST" {
+		s.githubCreate(w, r, s.User, false)
+		return
+	}
+	if v, ok := match(segs, "orgs/*/repos"); ok && r.Method == "POST" {
+		s.githubCreate(w, r, v[0], true)
+		return
+	}
+
+	// Single repositories
+	var repo *Repo
+	if len(segs) >= 3 && segs[0] == "repos" {
+		repo = s.repo(segs[1], segs[2])
+	}
+	if repo == nil || !s.visible(repo) {
+		s.apiError(w, http.StatusNotFound, "")
+		return
+	}
+
+	if _, ok := match(segs, "repos/*/*"); ok {
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, s.githubRepo(repo))
+		case "PATCH":
+			s.githubEdit(w, r, repo)
+		case "DELETE":
+			delete(s.repos, strings.ToLower(repo.FullName()))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			s.apiError(w, http.StatusNotFound, "")
+		}
+		return
+	}
+	if v, ok := match(segs, "repos/*/*/contents/**"); ok && r.Method == "PUT" {
+		s.githubCreateFile(w, r, repo, v[2])
+		return
+	}
+	if _, ok := match(segs, "repos/*/*/forks"); ok && r.Method == "POST" {
+		s.githubFork(w, r, repo)
+		return
+	}
+
+	s.apiError(w, http.StatusNotFound, "")
+}
+
+// githubOwner converts a user or an organisation
+func (s *Server) githubOwner(ns *namespace) githubOwner {
+
+	typ := "User"
+	if ns.Org {
+		typ = "Organization"
+	}
+
+	return githubOwner{Login: ns.Path, ID: ns.ID, Type: typ}
+}
+
+// githubRepo converts a repository, internal repositories are private with the visibility internal
+func (s *Server) githubRepo(repo *Repo) *githubRepo {
+
+	r := &githubRepo{
+		ID:            repo.ID,
+		Name:          repo.Name,
+		FullName:      repo.FullName(),
+		Owner:         s.githubOwner(s.namespaces[strings.ToLower(repo.Owner)]),
+		Private:       repo.Visibility != remote.VisibilityPublic,
+		Visibility:    string(repo.Visibility),
+		Fork:          repo.Parent != "",
+		HTMLURL:       s.URL + "/" + repo.FullName(),
+		CloneURL:      s.cloneURL(repo),
+		SSHURL:        s.sshURL(repo),
+		DefaultBranch: defaultBranch(repo),
+		Archived:      repo.Archived,
+		Size:          size(repo),
+		CreatedAt:     repo.Created,
+		UpdatedAt:     repo.Updated,
+		PushedAt:      repo.Updated,
+	}
+	if parent := s.repos[strings.ToLower(repo.Parent)]; parent != nil {
+		r.Parent = s.githubRepo(parent)
+	}
+
+	return r
+}
+
+// githubUnprocessable answers with a validation error of the field name
+func (s *Server) githubUnprocessable(w http.ResponseWriter, message, field string) {
+
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"message": "Validation Failed",
+		"errors": []map[string]string{
+			{"resource": "Repository", "code": "custom", "field": field, "message": message},
+		},
+		"documentation_url": "https://docs.github.com/rest",
+	})
+}
+
+// githubVisibility returns the visibility requested by private and visibility, the visibility takes precedence
+func githubVisibility(req *githubRepoRequest, current remote.Visibility) (remote.Visibility, error) {
+
+	v := current
+	if req.Private != nil {
+		v = remote.VisibilityPublic
+		if *req.Private {
+			v = remote.VisibilityPrivate
+		}
+	}
+	if req.Visibility != nil {
+		return remote.ParseVisibility(*req.Visibility)
+	}
+
+	return v, nil
+}
+
+// githubCreate creates a repository of the user or the organisation owner
+func (s *Server) githubCreate(w http.ResponseWriter, r *http.Request, owner string, org bool) {
+
+	ns := s.namespaces[strings.ToLower(owner)]
+	if ns == nil || ns.Org != org {
+		s.apiError(w, http.StatusNotFound, "")
+		return
+	}
+
+	req := new(githubRepoRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Name == nil || *req.Name == "" {
+		s.githubUnprocessable(w, "name is too short (minimum is 1 character)", "name")
+		return
+	}
+	if s.repo(ns.Path, *req.Name) != nil {
+		s.githubUnprocessable(w, "name already exists on this account", "name")
+		return
+	}
+	visibility, err := githubVisibility(req, remote.VisibilityPublic)
+	if err != nil {
+		s.githubUnprocessable(w, err.Error(), "visibility")
+		return
+	}
+	if visibility == remote.VisibilityInternal && !ns.Org {
+		s.githubUnprocessable(w, "internal repositories can only be created by organizations", "visibility")
+		return
+	}
+
+	repo := s.newRepo(ns, *req.Name, visibility)
+	if req.AutoInit {
+		s.commitFile(repo, "README.md", []byte("# "+repo.Name+"\n"), "Initial commit")
+	}
+
+	writeJSON(w, http.StatusCreated, s.githubRepo(repo))
+}
+
+// githubEdit changes the name, the visibility or the archived flag of a repository
+func (s *Server) githubEdit(w http.ResponseWriter, r *http.Request, repo *Repo) {
+
+	req := new(githubRepoRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	visibility, err := githubVisibility(req, repo.Visibility)
+	if err != nil {
+		s.githubUnprocessable(w, err.Error(), "visibility")
+		return
+	}
+	if visibility == remote.VisibilityInternal && !s.namespaces[strings.ToLower(repo.Owner)].Org {
+		s.githubUnprocessable(w, "only organization repositories can be internal", "visibility")
+		return
+	}
+	if req.Name != nil && *req.Name != repo.Name {
+		if *req.Name == "" {
+			s.githubUnprocessable(w, "name is too short (minimum is 1 character)", "name")
+			return
+		}
+		if existing := s.repo(repo.Owner, *req.Name); existing != nil && existing != repo {
+			s.githubUnprocessable(w, "name already exists on this account", "name")
+			return
+		}
+		s.renameRepo(repo, *req.Name)
+	}
+
+	repo.Visibility = visibility
+	if req.Archived != nil {
+		repo.Archived = *req.Archived
+	}
+	repo.Updated = s.now()
+
+	writeJSON(w, http.StatusOK, s.githubRepo(repo))
+}
+
+// githubCreateFile commits a new file to the default branch
+func (s *Server) githubCreateFile(w http.ResponseWriter, r *http.Request, repo *Repo, path string) {
+
+	if repo.Archived {
+		s.apiError(w, http.StatusForbidden, "Repository was archived so is read-only.")
+		return
+	}
+
+	req := new(githubFileRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.SHA == "" && fileExists(repo, path) {
+		s.githubUnprocessable(w, "\"sha\" wasn't supplied.", "sha")
+		return
+	}
+
+	err := s.commitFile(repo, path, req.Content, req.Message)
+	if err != nil {
+		s.githubUnprocessable(w, err.Error(), "path")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"content": map[string]string{"name": path, "path": path},
+		"commit":  map[string]string{"message": req.Message},
+	})
+}
+
+// githubFork forks a repository to the user or the organisation of the query parameter organization.
+// GitHub creates forks in the background and answers with 202 Accepted, an existing fork is returned again.
+func (s *Server) githubFork(w http.ResponseWriter, r *http.Request, repo *Repo) {
+
+	owner := s.User
+	if org := r.URL.Query().Get("organization"); org != "" {
+		ns := s.namespaces[strings.ToLower(org)]
+		if ns == nil || !ns.Org {
+			s.githubUnprocessable(w, "Invalid organization", "organization")
+			return
+		}
+		owner = ns.Path
+	}
+
+	fork := s.repo(owner, repo.Name)
+	if fork != nil && !strings.EqualFold(fork.Parent, repo.FullName()) {
+		s.githubUnprocessable(w, "name already exists on this account", "name")
+		return
+	}
+	if fork == nil {
+		fork = s.forkRepo(repo, s.namespaces[strings.ToLower(owner)], repo.Name)
+	}
+
+	writeJSON(w, http.StatusAccepted, s.githubRepo(fork))
+}
+
+// githubList lists the repositories of owner, which is the user, another user or an organisation.
+// Listings are filtered by the query parameter type and sorted by sort and direction like GitHub.
+func (s *Server) githubList(w http.ResponseWriter, r *http.Request, owner string) {
+
+	ns := s.namespaces[strings.ToLower(owner)]
+	if ns == nil {
+		s.apiError(w, http.StatusNotFound, "")
+		return
+	}
+	isUser := strings.EqualFold(owner, s.User) && strings.HasPrefix(r.URL.Path, githubPrefix+"/user/")
+
+	q := r.URL.Query()
+	typ := q.Get("type")
+	if typ == "" {
+		typ = "all"
+		if !ns.Org && !isUser {
+			typ = "owner"
+		}
+	}
+
+	// The user sees the repositories of all organisations
+	owners := []string{ns.Path}
+	if isUser && (typ == "all" || typ == "member") {
+		for _, o := range s.namespaces {
+			if o.Org {
+				owners = append(owners, o.Path)
+			}
+		}
+	}
+
+	repos := []*Repo{}
+	for _, repo := range s.ownedBy(owners...) {
+		if !s.visible(repo) {
+			continue
+		}
+		own := strings.EqualFold(repo.Owner, ns.Path)
+		keep := true
+		switch typ {
+		case "all":
+		case "owner":
+			keep = own
+		case "member":
+			keep = !own || ns.Org
+		case "public":
+			keep = repo.Visibility == remote.VisibilityPublic
+		case "private":
+			keep = repo.Visibility != remote.VisibilityPublic
+		case "forks":
+			keep = repo.Parent != ""
+		case "sources":
+			keep = repo.Parent == ""
+		default:
+			s.githubUnprocessable(w, "Invalid type "+typ, "type")
+			return
+		}
+		if keep {
+			repos = append(repos, repo)
+		}
+	}
+
+	// Repositories of the user are sorted by full_name by default
+	sortBy := q.Get("sort")
+	if sortBy == "" {
+		sortBy = "full_name"
+		if !isUser {
+			sortBy = "created"
+		}
+	}
+	desc := sortBy != "full_name"
+	if d := q.Get("direction"); d != "" {
+		desc = d == "desc"
+	}
+	sort.SliceStable(repos, func(i, j int) bool {
+		a, b := repos[i], repos[j]
+		if desc {
+			a, b = b, a
+		}
+		switch sortBy {
+		case "created":
+			return a.Created.Before(b.Created)
+		case "updated", "pushed":
+			return a.Updated.Before(b.Updated)
+		}
+		return strings.ToLower(a.FullName()) < strings.ToLower(b.FullName())
+	})
+
+	start, end := s.paginate(w, r, len(repos))
+	page := make([]*githubRepo, 0, end-start)
+	for _, repo := range repos[start:end] {
+		page = append(page, s.githubRepo(repo))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
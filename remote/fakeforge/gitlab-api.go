@@ -0,0 +1,470 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fakeforge
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wpueschel/gitrc/remote"
+)
+
+// gitlabPrefix is the path of the GitLab api
+const gitlabPrefix = "/api/v4"
+
+// gitlabNamespace is a user or group namespace in the GitLab api
+type gitlabNamespace struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	FullPath string `json:"full_path"`
+	ParentID int    `json:"parent_id,omitempty"`
+}
+
+// gitlabStatistics are the statistics of a project
+type gitlabStatistics struct {
+	RepositorySize int64 `json:"repository_size"`
+}
+
+// gitlabProject is a project in the GitLab api
+type gitlabProject struct {
+	ID                int               `json:"id"`
+	Name              string            `json:"name"`
+	Path              string            `json:"path"`
+	NameWithNamespace string            `json:"name_with_namespace"`
+	PathWithNamespace string            `json:"path_with_namespace"`
+	Visibility        string            `json:"visibility"`
+	DefaultBranch     string            `json:"default_branch,omitempty"`
+	SSHURLToRepo      string            `json:"ssh_url_to_repo"`
+	HTTPURLToRepo     string            `json:"http_url_to_repo"`
+	WebURL            string            `json:"web_url"`
+	Archived          bool              `json:"archived"`
+	CreatedAt         time.Time         `json:"created_at"`
+	LastActivityAt    time.Time         `json:"last_activity_at"`
+	Namespace         gitlabNamespace   `json:"namespace"`
+	ForkedFromProject *gitlabProject    `json:"forked_from_project,omitempty"`
+	Statistics        *gitlabStatistics `json:"statistics,omitempty"`
+}
+
+// gitlabProjectRequest is the body of create, edit and fork requests.
+// The namespace of a fork is given by its id or its full path.
+type gitlabProjectRequest struct {
+	Name        *string          `json:"name"`
+	Path        *string          `json:"path"`
+	Visibility  *string          `json:"visibility"`
+	NamespaceID *int             `json:"namespace_id"`
+	Namespace   *json.RawMessage `json:"namespace"`
+}
+
+// gitlabFileRequest is the body of a request creating a file
+type gitlabFileRequest struct {
+	Branch        string `json:"branch"`
+	Content       string `json:"content"`
+	CommitMessage string `json:"commit_message"`
+}
+
+// serveGitLab answers a request to the GitLab api
+func (s *Server) serveGitLab(w http.ResponseWriter, r *http.Request) {
+
+	segs, ok := segments(r, gitlabPrefix)
+	if !ok {
+		s.apiError(w, http.StatusNotFound, "")
+		return
+	}
+
+	if v, ok := match(segs, "namespaces/*"); ok && r.Method == "GET" {
+		ns := s.gitlabNamespaceByID(v[0])
+		if ns == nil {
+			s.apiError(w, http.StatusNotFound, "404 Namespace Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.gitlabNamespace(ns))
+		return
+	}
+	if v, ok := match(segs, "users/*/projects"); ok && r.Method == "GET" {
+		ns := s.gitlabNamespaceByID(v[0])
+		if ns == nil || ns.Org {
+			s.apiError(w, http.StatusNotFound, "404 User Not Found")
+			return
+		}
+		s.gitlabList(w, r, ns, false)
+		return
+	}
+	if v, ok := match(segs, "groups/*/projects"); ok && r.Method == "GET" {
+		ns := s.gitlabNamespaceByID(v[0])
+		if ns == nil || !ns.Org {
+			s.apiError(w, http.StatusNotFound, "404 Group Not Found")
+			return
+		}
+		s.gitlabList(w, r, ns, r.URL.Query().Get("include_subgroups") == "true")
+		return
+	}
+	if _, ok := match(segs, "projects"); ok && r.Method == "POST" {
+		s.gitlabCreate(w, r)
+		return
+	}
+
+	// Single projects are found by their id or their path with namespace
+	var repo *Repo
+	if len(segs) >= 2 && segs[0] == "projects" {
+		repo = s.gitlabProjectByID(segs[1])
+	}
+	if repo == nil || !s.visible(repo) {
+		s.apiError(w, http.StatusNotFound, "404 Project Not Found")
+		return
+	}
+
+	if _, ok := match(segs, "projects/*"); ok {
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, s.gitlabProject(repo, r.URL.Query().Get("statistics") == "true"))
+		case "PUT":
+			s.gitlabEdit(w, r, repo)
+		case "DELETE":
+			delete(s.repos, strings.ToLower(repo.FullName()))
+			writeJSON(w, http.StatusAccepted, map[string]string{"message": "202 Accepted"})
+		default:
+			s.apiError(w, http.StatusNotFound, "")
+		}
+		return
+	}
+	if _, ok := match(segs, "projects/*/archive"); ok && r.Method == "POST" {
+		repo.Archived = true
+		writeJSON(w, http.StatusCreated, s.gitlabProject(repo, false))
+		return
+	}
+	if _, ok := match(segs, "projects/*/unarchive"); ok && r.Method == "POST" {
+		repo.Archived = false
+		writeJSON(w, http.StatusCreated, s.gitlabProject(repo, false))
+		return
+	}
+	if _, ok := match(segs, "projects/*/fork"); ok && r.Method == "POST" {
+		s.gitlabFork(w, r, repo)
+		return
+	}
+	if v, ok := match(segs, "projects/*/repository/files/*"); ok && r.Method == "POST" {
+		s.gitlabCreateFile(w, r, repo, v[1])
+		return
+	}
+
+	s.apiError(w, http.StatusNotFound, "")
+}
+
+// gitlabNamespaceByID returns the namespace with the numeric id or the full path id
+func (s *Server) gitlabNamespaceByID(id string) *namespace {
+
+	if n, err := strconv.Atoi(id); err == nil {
+		for _, ns := range s.namespaces {
+			if ns.ID == n {
+				return ns
+			}
+		}
+		return nil
+	}
+
+	return s.namespaces[strings.ToLower(id)]
+}
+
+// gitlabProjectByID returns the project with the numeric id or the path with namespace id
+func (s *Server) gitlabProjectByID(id string) *Repo {
+
+	if n, err := strconv.Atoi(id); err == nil {
+		for _, repo := range s.repos {
+			if repo.ID == n {
+				return repo
+			}
+		}
+		return nil
+	}
+
+	return s.repos[strings.ToLower(id)]
+}
+
+// gitlabNamespace converts a namespace, groups may be nested
+func (s *Server) gitlabNamespace(ns *namespace) gitlabNamespace {
+
+	n := gitlabNamespace{ID: ns.ID, Path: ns.Path, FullPath: ns.Path, Kind: "user"}
+	if i := strings.LastIndex(ns.Path, "/"); i >= 0 {
+		n.Path = ns.Path[i+1:]
+		if parent := s.namespaces[strings.ToLower(ns.Path[:i])]; parent != nil {
+			n.ParentID = parent.ID
+		}
+	}
+	n.Name = n.Path
+	if ns.Org {
+		n.Kind = "group"
+	}
+
+	return n
+}
+
+// gitlabProject converts a repository, statistics are only included if they were requested
+func (s *Server) gitlabProject(repo *Repo, statistics bool) *gitlabProject {
+
+	p := &gitlabProject{
+		ID:                repo.ID,
+		Name:              repo.Name,
+		Path:              repo.Name,
+		NameWithNamespace: strings.Replace(repo.FullName(), "/", " / ", -1),
+		PathWithNamespace: repo.FullName(),
+		Visibility:        string(repo.Visibility),
+		DefaultBranch:     defaultBranch(repo),
+		SSHURLToRepo:      s.sshURL(repo),
+		HTTPURLToRepo:     s.cloneURL(repo),
+		WebURL:            s.URL + "/" + repo.FullName(),
+		Archived:          repo.Archived,
+		CreatedAt:         repo.Created,
+		LastActivityAt:    repo.Updated,
+		Namespace:         s.gitlabNamespace(s.namespaces[strings.ToLower(repo.Owner)]),
+	}
+	if parent := s.repos[strings.ToLower(repo.Parent)]; parent != nil {
+		p.ForkedFromProject = s.gitlabProject(parent, false)
+	}
+	if statistics {
+		p.Statistics = &gitlabStatistics{RepositorySize: int64(size(repo)) * 1024}
+	}
+
+	return p
+}
+
+// gitlabTaken answers with the validation error of a name, which is already taken
+func gitlabTaken(w http.ResponseWriter, status int) {
+
+	writeJSON(w, status, map[string]interface{}{
+		"message": map[string][]string{
+			"name": {"has already been taken"},
+			"path": {"has already been taken"},
+		},
+	})
+}
+
+// gitlabCreate creates a project in the namespace of namespace_id or of the user.
+// Projects are private by default.
+func (s *Server) gitlabCreate(w http.ResponseWriter, r *http.Request) {
+
+	req := new(gitlabProjectRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := ""
+	if req.Path != nil {
+		name = *req.Path
+	} else if req.Name != nil {
+		name = *req.Name
+	}
+	if name == "" {
+		s.apiError(w, http.StatusBadRequest, "name is missing, path is missing")
+		return
+	}
+
+	ns := s.namespaces[strings.ToLower(s.User)]
+	if req.NamespaceID != nil {
+		ns = s.gitlabNamespaceByID(strconv.Itoa(*req.NamespaceID))
+		if ns == nil {
+			s.apiError(w, http.StatusNotFound, "404 Namespace Not Found")
+			return
+		}
+	}
+	if s.repo(ns.Path, name) != nil {
+		gitlabTaken(w, http.StatusBadRequest)
+		return
+	}
+
+	visibility := remote.VisibilityPrivate
+	if req.Visibility != nil {
+		v, err := remote.ParseVisibility(*req.Visibility)
+		if err != nil {
+			s.apiError(w, http.StatusBadRequest, "visibility does not have a valid value")
+			return
+		}
+		visibility = v
+	}
+
+	repo := s.newRepo(ns, name, visibility)
+
+	writeJSON(w, http.StatusCreated, s.gitlabProject(repo, false))
+}
+
+// gitlabEdit changes the name, the path or the visibility of a project.
+// The fake forge does not distinguish between the name and the path of projects.
+func (s *Server) gitlabEdit(w http.ResponseWriter, r *http.Request, repo *Repo) {
+
+	req := new(gitlabProjectRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	visibility := repo.Visibility
+	if req.Visibility != nil {
+		v, err := remote.ParseVisibility(*req.Visibility)
+		if err != nil {
+			s.apiError(w, http.StatusBadRequest, "visibility does not have a valid value")
+			return
+		}
+		visibility = v
+	}
+
+	name := repo.Name
+	if req.Path != nil {
+		name = *req.Path
+	} else if req.Name != nil {
+		name = *req.Name
+	}
+	if name != repo.Name {
+		if existing := s.repo(repo.Owner, name); existing != nil && existing != repo {
+			gitlabTaken(w, http.StatusBadRequest)
+			return
+		}
+		s.renameRepo(repo, name)
+	}
+
+	repo.Visibility = visibility
+	repo.Updated = s.now()
+
+	writeJSON(w, http.StatusOK, s.gitlabProject(repo, false))
+}
+
+// gitlabFork forks a project into the namespace given by id or path or into the namespace of the user
+func (s *Server) gitlabFork(w http.ResponseWriter, r *http.Request, repo *Repo) {
+
+	req := new(gitlabProjectRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ns := s.namespaces[strings.ToLower(s.User)]
+	if req.Namespace != nil {
+		var id interface{}
+		json.Unmarshal(*req.Namespace, &id)
+		switch v := id.(type) {
+		case float64:
+			ns = s.gitlabNamespaceByID(strconv.Itoa(int(v)))
+		case string:
+			ns = s.gitlabNamespaceByID(v)
+		}
+		if ns == nil {
+			s.apiError(w, http.StatusNotFound, "404 Target Namespace Not Found")
+			return
+		}
+	}
+
+	name := repo.Name
+	if req.Path != nil {
+		name = *req.Path
+	}
+	if s.repo(ns.Path, name) != nil {
+		gitlabTaken(w, http.StatusConflict)
+		return
+	}
+
+	fork := s.forkRepo(repo, ns, name)
+
+	writeJSON(w, http.StatusCreated, s.gitlabProject(fork, false))
+}
+
+// gitlabCreateFile commits a new file to the default branch
+func (s *Server) gitlabCreateFile(w http.ResponseWriter, r *http.Request, repo *Repo, path string) {
+
+	if repo.Archived {
+		s.apiError(w, http.StatusForbidden, "")
+		return
+	}
+
+	req := new(gitlabFileRequest)
+	if err := readJSON(r, req); err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Branch == "" || req.CommitMessage == "" {
+		s.apiError(w, http.StatusBadRequest, "branch is missing, commit_message is missing")
+		return
+	}
+	if req.Branch != defaultBranch(repo) {
+		s.apiError(w, http.StatusBadRequest, "You can only create files on the default branch")
+		return
+	}
+	if fileExists(repo, path) {
+		s.apiError(w, http.StatusBadRequest, "A file with this name already exists")
+		return
+	}
+
+	err := s.commitFile(repo, path, []byte(req.Content), req.CommitMessage)
+	if err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"file_path": path, "branch": req.Branch})
+}
+
+// gitlabList lists the projects of a user or a group namespace and optionally of its subgroups.
+// Listings are sorted by order_by and sort, by default the newest projects come first.
+func (s *Server) gitlabList(w http.ResponseWriter, r *http.Request, ns *namespace, subgroups bool) {
+
+	owners := []string{ns.Path}
+	if subgroups {
+		for _, o := range s.namespaces {
+			if strings.HasPrefix(strings.ToLower(o.Path), strings.ToLower(ns.Path)+"/") {
+				owners = append(owners, o.Path)
+			}
+		}
+	}
+
+	repos := []*Repo{}
+	for _, repo := range s.ownedBy(owners...) {
+		if s.visible(repo) {
+			repos = append(repos, repo)
+		}
+	}
+
+	q := r.URL.Query()
+	orderBy := q.Get("order_by")
+	desc := q.Get("sort") != "asc"
+	sort.SliceStable(repos, func(i, j int) bool {
+		a, b := repos[i], repos[j]
+		if desc {
+			a, b = b, a
+		}
+		switch orderBy {
+		case "last_activity_at", "updated_at":
+			return a.Updated.Before(b.Updated)
+		case "name", "path":
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		case "id":
+			return a.ID < b.ID
+		}
+		return a.Created.Before(b.Created)
+	})
+
+	start, end := s.paginate(w, r, len(repos))
+	statistics := q.Get("statistics") == "true"
+	page := make([]*gitlabProject, 0, end-start)
+	for _, repo := range repos[start:end] {
+		page = append(page, s.gitlabProject(repo, statistics))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
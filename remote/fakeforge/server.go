@@ -0,0 +1,699 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package fakeforge provides an in-memory forge for tests.
+// A Server emulates the subset of the GitHub, GitLab or Gitea REST api used by gitrc
+// and serves its repositories over smart HTTP, so remotes can be tested without network access:
+//
+//	s := fakeforge.New(fakeforge.GitHub, "alice")
+//	defer s.Close()
+//	r, err := remote.New("github", s.Provider())
+package fakeforge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wpueschel/gitrc/remote"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// Flavours of the emulated api
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+	Gitea  = "gitea"
+)
+
+// Token is the token a new Server accepts
+const Token = "fake-token"
+
+// Repo is a repository of the fake forge
+type Repo struct {
+	ID         int
+	Owner      string
+	Name       string
+	Visibility remote.Visibility
+	Archived   bool
+	// Parent is the full name of the forked repository, it is empty for repositories, which are no forks
+	Parent  string
+	Created time.Time
+	Updated time.Time
+	// Storage contains the git objects and references of the repository
+	Storage *memory.Storage
+}
+
+// FullName returns the name of the repository with its owner
+func (r *Repo) FullName() string {
+	return r.Owner + "/" + r.Name
+}
+
+// namespace is a user or an organisation, which is a group on GitLab
+type namespace struct {
+	ID   int
+	Path string
+	Org  bool
+}
+
+// failure is a response to inject into the next matching request
+type failure struct {
+	method string
+	path   string
+	status int
+}
+
+// Server is a fake forge.
+// The fields can be changed after New, before the first request is sent.
+type Server struct {
+	// URL is the base url of the server, e.g. http://127.0.0.1:43521
+	URL string
+	// Flavour is the emulated api, GitHub, GitLab or Gitea
+	Flavour string
+	// User is the user authenticated by Token
+	User string
+	// Token authenticates api requests and http clones, if it is empty, all requests are accepted
+	Token string
+	// PerPage is the page size of listings without per_page, MaxPerPage is the largest page size
+	PerPage    int
+	MaxPerPage int
+
+	server     *httptest.Server
+	mu         sync.Mutex
+	namespaces map[string]*namespace
+	repos      map[string]*Repo
+	nextID     int
+	clock      time.Time
+	rateLimit  int
+	failures   []failure
+	requests   []string
+}
+
+// New starts a fake forge with the api flavour, on which user is authenticated by Token.
+// New panics, if flavour is unknown.
+func New(flavour, user string) *Server {
+
+	s := &Server{
+		Flavour:    flavour,
+		User:       user,
+		Token:      Token,
+		namespaces: make(map[string]*namespace),
+		repos:      make(map[string]*Repo),
+		rateLimit:  -1,
+	}
+
+	switch flavour {
+	case GitHub:
+		s.PerPage, s.MaxPerPage = 30, 100
+	case GitLab:
+		s.PerPage, s.MaxPerPage = 20, 100
+	case Gitea:
+		s.PerPage, s.MaxPerPage = 30, 50
+	default:
+		panic("fakeforge: unknown flavour " + flavour)
+	}
+
+	s.addNamespace(user, false)
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Provider returns the settings of a gitrc remote for the server, which clones over http
+func (s *Server) Provider() remote.Provider {
+	return remote.Provider{
+		Type:          s.Flavour,
+		HostBaseURL:   s.URL,
+		User:          s.User,
+		Token:         s.Token,
+		Password:      s.Token,
+		CloneProtocol: "http",
+	}
+}
+
+// AddUser adds another user, whose public repositories are visible
+func (s *Server) AddUser(name string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addNamespace(name, false)
+}
+
+// AddOrg adds an organisation, the user is a member of all organisations.
+// On GitLab the name is the full path of a group, e.g. platform/backend, missing parent groups are added as well.
+func (s *Server) AddOrg(name string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(name, "/")
+	for i := range parts {
+		s.addNamespace(strings.Join(parts[:i+1], "/"), true)
+	}
+}
+
+// addNamespace adds a user or an organisation, if it doesn't exist yet
+func (s *Server) addNamespace(path string, org bool) *namespace {
+
+	if ns := s.namespaces[strings.ToLower(path)]; ns != nil {
+		return ns
+	}
+
+	s.nextID++
+	ns := &namespace{ID: s.nextID, Path: path, Org: org}
+	s.namespaces[strings.ToLower(path)] = ns
+
+	return ns
+}
+
+// AddRepo adds the repository fullName ("owner/name") with a commit of a basic README.
+// The owner is added as user, if it doesn't exist.
+func (s *Server) AddRepo(fullName string, visibility remote.Visibility) Repo {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := strings.LastIndex(fullName, "/")
+	if i < 0 {
+		panic("fakeforge: repository without owner " + fullName)
+	}
+	ns := s.namespaces[strings.ToLower(fullName[:i])]
+	if ns == nil {
+		ns = s.addNamespace(fullName[:i], false)
+	}
+
+	r := s.newRepo(ns, fullName[i+1:], visibility)
+	err := s.commitFile(r, "README.md", []byte(fmt.Sprintf("# %s\n", r.Name)), "Added a README")
+	if err != nil {
+		panic("fakeforge: " + err.Error())
+	}
+
+	return *r
+}
+
+// Repo returns a copy of the repository fullName and if it exists
+func (s *Server) Repo(fullName string) (Repo, bool) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repos[strings.ToLower(fullName)]
+	if r == nil {
+		return Repo{}, false
+	}
+
+	return *r, true
+}
+
+// Repos returns copies of all repositories sorted by their full name
+func (s *Server) Repos() []Repo {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repos := make([]Repo, 0, len(s.repos))
+	for _, r := range s.repos {
+		repos = append(repos, *r)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return strings.ToLower(repos[i].FullName()) < strings.ToLower(repos[j].FullName())
+	})
+
+	return repos
+}
+
+// SetRateLimit allows remaining more api requests, after which requests fail with the rate limit error of the flavour.
+// A negative value removes the rate limit.
+func (s *Server) SetRateLimit(remaining int) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateLimit = remaining
+}
+
+// Fail answers the next request with method, whose path starts with path, with an error of the given status,
+// e.g. Fail("POST", "/api/v3/user/repos", 500)
+func (s *Server) Fail(method, path string, status int) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, failure{method: method, path: path, status: status})
+}
+
+// Requests returns all requests received so far as method and url, e.g. "GET /api/v3/user/repos?page=2"
+func (s *Server) Requests() []string {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// now returns the current time in seconds, it is later than all times returned before,
+// so the repositories changed last are the most recently updated ones
+func (s *Server) now() time.Time {
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if !now.After(s.clock) {
+		now = s.clock.Add(time.Second)
+	}
+	s.clock = now
+
+	return now
+}
+
+// newRepo adds an empty repository, whose HEAD points to master
+func (s *Server) newRepo(ns *namespace, name string, visibility remote.Visibility) *Repo {
+
+	s.nextID++
+	r := &Repo{
+		ID:         s.nextID,
+		Owner:      ns.Path,
+		Name:       name,
+		Visibility: visibility,
+		Storage:    memory.NewStorage(),
+	}
+	r.Created = s.now()
+	r.Updated = r.Created
+	r.Storage.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master))
+	s.repos[strings.ToLower(r.FullName())] = r
+
+	return r
+}
+
+// repo returns the repository owner/name
+func (s *Server) repo(owner, name string) *Repo {
+	return s.repos[strings.ToLower(owner+"/"+name)]
+}
+
+// renameRepo changes the name of a repository
+func (s *Server) renameRepo(r *Repo, name string) {
+	delete(s.repos, strings.ToLower(r.FullName()))
+	r.Name = name
+	s.repos[strings.ToLower(r.FullName())] = r
+}
+
+// forkRepo copies a repository with all objects and references to name of the namespace ns
+func (s *Server) forkRepo(repo *Repo, ns *namespace, name string) *Repo {
+
+	fork := s.newRepo(ns, name, repo.Visibility)
+	fork.Parent = repo.FullName()
+
+	for _, o := range repo.Storage.Objects {
+		fork.Storage.SetEncodedObject(o)
+	}
+	for name, ref := range repo.Storage.ReferenceStorage {
+		fork.Storage.ReferenceStorage[name] = ref
+	}
+
+	return fork
+}
+
+// fileExists checks if the last commit on the default branch contains the file path
+func fileExists(repo *Repo, path string) bool {
+
+	ref, err := repo.Storage.Reference(plumbing.HEAD)
+	if err == nil && ref.Type() == plumbing.SymbolicReference {
+		ref, err = repo.Storage.Reference(ref.Target())
+	}
+	if err != nil {
+		return false
+	}
+	commit, err := object.GetCommit(repo.Storage, ref.Hash())
+	if err != nil {
+		return false
+	}
+	_, err = commit.File(path)
+
+	return err == nil
+}
+
+// ownedBy returns the repositories of owner sorted by the order of the flavour
+func (s *Server) ownedBy(owners ...string) []*Repo {
+
+	repos := []*Repo{}
+	for _, r := range s.repos {
+		for _, o := range owners {
+			if strings.EqualFold(r.Owner, o) {
+				repos = append(repos, r)
+				break
+			}
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].ID < repos[j].ID })
+
+	return repos
+}
+
+// visible checks if the authenticated user can see the repository, the user is a member of all organisations
+func (s *Server) visible(r *Repo) bool {
+
+	if r.Visibility != remote.VisibilityPrivate || strings.EqualFold(r.Owner, s.User) {
+		return true
+	}
+	ns := s.namespaces[strings.ToLower(r.Owner)]
+
+	return ns != nil && ns.Org
+}
+
+// defaultBranch returns the branch HEAD points to
+func defaultBranch(r *Repo) string {
+
+	head, err := r.Storage.Reference(plumbing.HEAD)
+	if err != nil || head.Type() != plumbing.SymbolicReference {
+		return ""
+	}
+
+	return head.Target().Short()
+}
+
+// size returns the size of the objects of a repository in KiB, rounded up like the forges do
+func size(r *Repo) int {
+
+	n := 0
+	for _, o := range r.Storage.Objects {
+		n += int(o.Size())
+	}
+
+	return (n + 1023) / 1024
+}
+
+// cloneURL returns the http clone url of a repository
+func (s *Server) cloneURL(r *Repo) string {
+	return s.URL + "/" + r.FullName() + ".git"
+}
+
+// sshURL returns the ssh clone url of a repository, the fake forge has no ssh server
+func (s *Server) sshURL(r *Repo) string {
+
+	u, _ := url.Parse(s.URL)
+
+	return fmt.Sprintf("git@%s:%s.git", u.Hostname(), r.FullName())
+}
+
+// serveHTTP logs the request and passes it to the git endpoint or the api of the flavour
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+
+	if isGitRequest(r) {
+		s.serveGit(w, r)
+		return
+	}
+
+	if f, ok := s.failure(r); ok {
+		s.apiError(w, f.status, http.StatusText(f.status))
+		return
+	}
+
+	if !s.authorized(r) {
+		s.apiError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	if s.rateLimit >= 0 {
+		if s.rateLimit == 0 {
+			s.rateLimited(w)
+			return
+		}
+		s.rateLimit--
+		s.rateLimitHeaders(w)
+	}
+
+	switch s.Flavour {
+	case GitHub:
+		s.serveGitHub(w, r)
+	case GitLab:
+		s.serveGitLab(w, r)
+	case Gitea:
+		s.serveGitea(w, r)
+	}
+}
+
+// failure returns and removes the first injected failure matching the request
+func (s *Server) failure(r *http.Request) (failure, bool) {
+
+	for i, f := range s.failures {
+		if f.method == r.Method && strings.HasPrefix(r.URL.EscapedPath(), f.path) {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			return f, true
+		}
+	}
+
+	return failure{}, false
+}
+
+// authorized checks the token of an api request, which is sent in the header of the flavour
+func (s *Server) authorized(r *http.Request) bool {
+
+	if s.Token == "" {
+		return true
+	}
+
+	auth := r.Header.Get("Authorization")
+	for _, scheme := range []string{"Bearer ", "token "} {
+		if strings.HasPrefix(auth, scheme) && strings.TrimPrefix(auth, scheme) == s.Token {
+			return true
+		}
+	}
+	if _, password, ok := r.BasicAuth(); ok && password == s.Token {
+		return true
+	}
+
+	return s.Flavour == GitLab && r.Header.Get("Private-Token") == s.Token
+}
+
+// rateLimitHeaders sets the headers reporting the remaining requests
+func (s *Server) rateLimitHeaders(w http.ResponseWriter) {
+
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	remaining := strconv.Itoa(s.rateLimit)
+
+	switch s.Flavour {
+	case GitHub:
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", remaining)
+		w.Header().Set("X-RateLimit-Reset", reset)
+	case GitLab:
+		w.Header().Set("RateLimit-Limit", "600")
+		w.Header().Set("RateLimit-Remaining", remaining)
+		w.Header().Set("RateLimit-Reset", reset)
+	}
+}
+
+// rateLimited answers a request after the rate limit was exceeded like the flavour:
+// GitHub with 403, GitLab and Gitea with 429 Too Many Requests
+func (s *Server) rateLimited(w http.ResponseWriter) {
+
+	s.rateLimitHeaders(w)
+	w.Header().Set("Retry-After", "3600")
+
+	if s.Flavour == GitHub {
+		s.apiError(w, http.StatusForbidden, fmt.Sprintf("API rate limit exceeded for user %s.", s.User))
+		return
+	}
+	s.apiError(w, http.StatusTooManyRequests, "Retry later")
+}
+
+// apiError writes an error response with the message of the flavour, an empty message is derived from status
+func (s *Server) apiError(w http.ResponseWriter, status int, message string) {
+
+	if message == "" {
+		message = http.StatusText(status)
+		switch {
+		case s.Flavour == GitHub && status == http.StatusUnauthorized:
+			message = "Bad credentials"
+		case s.Flavour == GitLab:
+			message = fmt.Sprintf("%d %s", status, message)
+		}
+	}
+
+	body := map[string]interface{}{"message": message}
+	switch s.Flavour {
+	case GitHub:
+		body["documentation_url"] = "https://docs.github.com/rest"
+	case Gitea:
+		body["url"] = s.URL + "/api/swagger"
+	}
+
+	writeJSON(w, status, body)
+}
+
+// writeJSON writes v as json response with status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// readJSON decodes the body of a request into v
+func readJSON(r *http.Request, v interface{}) error {
+
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("Problems parsing JSON: %s", err)
+	}
+
+	return nil
+}
+
+// segments splits the escaped path of a request below prefix into its unescaped segments.
+// Escaped slashes, e.g. in GitLab project paths, stay in their segment.
+func segments(r *http.Request, prefix string) ([]string, bool) {
+
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, prefix) {
+		return nil, false
+	}
+
+	segs := strings.Split(strings.Trim(strings.TrimPrefix(path, prefix), "/"), "/")
+	for i, seg := range segs {
+		unescaped, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, false
+		}
+		segs[i] = unescaped
+	}
+
+	return segs, true
+}
+
+// match matches the path segments against a pattern like "repos/*/*/forks", the values of the wildcards are returned.
+// A trailing "**" matches the remaining segments as one value joined by slashes.
+func match(segs []string, pattern string) ([]string, bool) {
+
+	parts := strings.Split(pattern, "/")
+	values := []string{}
+
+	for i, p := range parts {
+		if p == "**" && i == len(parts)-1 && len(segs) > i {
+			return append(values, strings.Join(segs[i:], "/")), true
+		}
+		if i >= len(segs) {
+			return nil, false
+		}
+		switch p {
+		case "*":
+			values = append(values, segs[i])
+		case segs[i]:
+		default:
+			return nil, false
+		}
+	}
+
+	if len(segs) != len(parts) {
+		return nil, false
+	}
+
+	return values, true
+}
+
+// paginate returns the bounds of the requested page of n items and sets the pagination headers of the flavour.
+// The page size is read from per_page, Gitea uses limit.
+func (s *Server) paginate(w http.ResponseWriter, r *http.Request, n int) (int, int) {
+
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	sizeParam := "per_page"
+	if s.Flavour == Gitea {
+		sizeParam = "limit"
+	}
+	perPage, _ := strconv.Atoi(q.Get(sizeParam))
+	if perPage < 1 {
+		perPage = s.PerPage
+	}
+	if perPage > s.MaxPerPage {
+		perPage = s.MaxPerPage
+	}
+
+	last := (n + perPage - 1) / perPage
+	if last < 1 {
+		last = 1
+	}
+
+	// Links to the other pages keep all parameters but the page
+	link := func(p int, rel string) string {
+		q.Set("page", strconv.Itoa(p))
+		q.Set(sizeParam, strconv.Itoa(perPage))
+		u := url.URL{Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: q.Encode()}
+		return fmt.Sprintf("<%s%s>; rel=\"%s\"", s.URL, u.String(), rel)
+	}
+	links := []string{}
+	if page < last {
+		links = append(links, link(page+1, "next"), link(last, "last"))
+	}
+	if page > 1 {
+		links = append(links, link(1, "first"), link(page-1, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	switch s.Flavour {
+	case GitLab:
+		next, prev := "", ""
+		if page < last {
+			next = strconv.Itoa(page + 1)
+		}
+		if page > 1 {
+			prev = strconv.Itoa(page - 1)
+		}
+		w.Header().Set("X-Page", strconv.Itoa(page))
+		w.Header().Set("X-Per-Page", strconv.Itoa(perPage))
+		w.Header().Set("X-Next-Page", next)
+		w.Header().Set("X-Prev-Page", prev)
+		w.Header().Set("X-Total", strconv.Itoa(n))
+		w.Header().Set("X-Total-Pages", strconv.Itoa(last))
+	case Gitea:
+		w.Header().Set("X-Total-Count", strconv.Itoa(n))
+	}
+
+	start := (page - 1) * perPage
+	if start > n {
+		start = n
+	}
+	end := start + perPage
+	if end > n {
+		end = n
+	}
+
+	return start, end
+}
@@ -0,0 +1,298 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wpueschel/gitrc/remote"
+	"github.com/wpueschel/gitrc/remote/fakeforge"
+)
+
+// forges are the flavours of the fake forge with the path of their api and of the listing of the user
+var forges = []struct {
+	flavour string
+	prefix  string
+	list    string
+}{
+	{fakeforge.GitHub, "/api/v3", "/api/v3/user/repos"},
+	{fakeforge.GitLab, "/api/v4", "/api/v4/users/alice/projects"},
+	{fakeforge.Gitea, "/api/v1", "/api/v1/user/repos"},
+}
+
+// newForgeRemote starts a fake forge of alice and returns it with a remote using it
+func newForgeRemote(t *testing.T, flavour string) (*fakeforge.Server, remote.Remote) {
+
+	s := fakeforge.New(flavour, "alice")
+	t.Cleanup(s.Close)
+
+	r, err := remote.New(flavour, s.Provider())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, r
+}
+
+// listRequests returns the listing requests of the user received by s
+func listRequests(s *fakeforge.Server, path string) []string {
+
+	reqs := []string{}
+	for _, req := range s.Requests() {
+		if strings.HasPrefix(req, "GET "+path+"?") {
+			reqs = append(reqs, req)
+		}
+	}
+
+	return reqs
+}
+
+func TestForgeRepos(t *testing.T) {
+
+	for _, f := range forges {
+		t.Run(f.flavour, func(t *testing.T) {
+
+			s, r := newForgeRemote(t, f.flavour)
+			ctx := context.Background()
+
+			repo, err := r.CreateRepo(ctx, "tool", &remote.CreateOptions{Visibility: remote.VisibilityPrivate})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repo.FullName != "alice/tool" || repo.Visibility != remote.VisibilityPrivate {
+				t.Errorf("Created %s with the visibility %s, want a private alice/tool", repo.FullName, repo.Visibility)
+			}
+			if created, ok := s.Repo("alice/tool"); !ok || created.Visibility != remote.VisibilityPrivate {
+				t.Errorf("Forge has no private alice/tool")
+			}
+
+			repos, err := r.ListRepos(ctx, nil).All()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(repos) != 1 || repos[0].FullName != "alice/tool" || repos[0].DefaultBranch != "master" {
+				t.Errorf("Listed %v, want alice/tool", repos)
+			}
+
+			// Clone over smart http
+			dir, err := ioutil.TempDir("", "gitrc-clone")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			err = r.CloneRepo(ctx, "alice/tool", &remote.CloneOptions{Dir: filepath.Join(dir, "tool")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			readme, err := ioutil.ReadFile(filepath.Join(dir, "tool", "README.md"))
+			if err != nil || !strings.Contains(string(readme), "tool") {
+				t.Errorf("Clone has the README %q: %v", readme, err)
+			}
+
+			err = r.DeleteRepo(ctx, "alice/tool")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := s.Repo("alice/tool"); ok {
+				t.Errorf("Repository was not deleted")
+			}
+			if err = r.DeleteRepo(ctx, "alice/tool"); err == nil {
+				t.Errorf("Deleting a missing repository succeeded")
+			}
+		})
+	}
+}
+
+func TestForgePagination(t *testing.T) {
+
+	for _, f := range forges {
+		t.Run(f.flavour, func(t *testing.T) {
+
+			s, r := newForgeRemote(t, f.flavour)
+			for i := 0; i < 120; i++ {
+				s.AddRepo(fmt.Sprintf("alice/repo-%03d", i), remote.VisibilityPublic)
+			}
+			ctx := context.Background()
+
+			repos, err := r.ListRepos(ctx, nil).All()
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[string]bool)
+			for _, repo := range repos {
+				seen[repo.FullName] = true
+			}
+			if len(repos) != 120 || len(seen) != 120 {
+				t.Errorf("Listed %d repositories, %d of them distinct, want 120", len(repos), len(seen))
+			}
+
+			// GitHub and GitLab page by the Link and X-Next-Page headers, Gitea until a page is empty
+			reqs := listRequests(s, f.list)
+			want := 2
+			if f.flavour == fakeforge.Gitea {
+				want = 4
+			}
+			if len(reqs) != want {
+				t.Errorf("Listing took the requests %v, want %d pages", reqs, want)
+			}
+			for i, req := range reqs {
+				if !strings.Contains(req, fmt.Sprintf("page=%d&", i+1)) && !strings.HasSuffix(req, fmt.Sprintf("page=%d", i+1)) {
+					t.Errorf("Request %d is %s, want page %d", i+1, req, i+1)
+				}
+			}
+
+			// A limit below the page size fetches a single small page, the sorted gitea listing is fetched completely
+			before := len(listRequests(s, f.list))
+			repos, err = r.ListRepos(ctx, &remote.ListOptions{Limit: 5}).All()
+			if err != nil {
+				t.Fatal(err)
+			}
+			reqs = listRequests(s, f.list)[before:]
+			want = 1
+			if f.flavour == fakeforge.Gitea {
+				want = 4
+			}
+			if len(repos) != 5 || len(reqs) != want {
+				t.Errorf("Listed %d repositories with the requests %v, want 5 with %d requests", len(repos), reqs, want)
+			}
+		})
+	}
+}
+
+func TestGiteaMaxResponseItems(t *testing.T) {
+
+	// Pages are smaller than requested, if MAX_RESPONSE_ITEMS of the server is below the page size
+	s, r := newForgeRemote(t, fakeforge.Gitea)
+	s.MaxPerPage = 20
+	for i := 0; i < 70; i++ {
+		s.AddRepo(fmt.Sprintf("alice/repo-%03d", i), remote.VisibilityPublic)
+	}
+
+	repos, err := r.ListRepos(context.Background(), nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 70 {
+		t.Errorf("Listed %d repositories, want 70", len(repos))
+	}
+}
+
+func TestGiteaOwnerLookup(t *testing.T) {
+
+	s, r := newForgeRemote(t, fakeforge.Gitea)
+	s.AddOrg("acme")
+	s.AddUser("bob")
+	s.AddRepo("acme/tool", remote.VisibilityPublic)
+	s.AddRepo("bob/lib", remote.VisibilityPublic)
+	ctx := context.Background()
+
+	for owner, want := range map[string]string{"acme": "acme/tool", "bob": "bob/lib"} {
+		repos, err := r.ListRepos(ctx, &remote.ListOptions{Owner: owner}).All()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(repos) != 1 || repos[0].FullName != want {
+			t.Errorf("Listed %v for %s, want %s", repos, owner, want)
+		}
+	}
+
+	// Only a missing organisation means that the owner is a user
+	s.Fail("GET", "/api/v1/orgs/acme", http.StatusInternalServerError)
+	_, err := r.ListRepos(ctx, &remote.ListOptions{Owner: "acme"}).All()
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Listing with a failing organisation lookup returned %v, want the status 500", err)
+	}
+}
+
+func TestForgeFail(t *testing.T) {
+
+	for _, f := range forges {
+		t.Run(f.flavour, func(t *testing.T) {
+
+			s, r := newForgeRemote(t, f.flavour)
+			s.AddRepo("alice/tool", remote.VisibilityPublic)
+			ctx := context.Background()
+
+			s.Fail("GET", f.list, http.StatusInternalServerError)
+			_, err := r.ListRepos(ctx, nil).All()
+			if err == nil || !strings.Contains(err.Error(), "500") {
+				t.Errorf("Listing with a failing server returned %v, want the status 500", err)
+			}
+
+			// Failures are only injected once
+			repos, err := r.ListRepos(ctx, nil).All()
+			if err != nil || len(repos) != 1 {
+				t.Errorf("Listing after a failure returned %v, %v", repos, err)
+			}
+
+			s.Fail("DELETE", f.prefix, http.StatusForbidden)
+			if err = r.DeleteRepo(ctx, "alice/tool"); err == nil {
+				t.Errorf("Deleting with a failing server succeeded")
+			}
+			if _, ok := s.Repo("alice/tool"); !ok {
+				t.Errorf("Repository was deleted by a failed request")
+			}
+		})
+	}
+}
+
+func TestForgeRateLimit(t *testing.T) {
+
+	for _, f := range forges {
+		t.Run(f.flavour, func(t *testing.T) {
+
+			s, r := newForgeRemote(t, f.flavour)
+			for i := 0; i < 120; i++ {
+				s.AddRepo(fmt.Sprintf("alice/repo-%03d", i), remote.VisibilityPublic)
+			}
+			ctx := context.Background()
+
+			// The remote checks the server once before its first listing
+			if _, err := r.ListRepos(ctx, &remote.ListOptions{Limit: 1}).All(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The first page is still allowed, the second exceeds the rate limit
+			s.SetRateLimit(1)
+			repos, err := r.ListRepos(ctx, nil).All()
+			if err == nil {
+				t.Errorf("Listing %d repositories beyond the rate limit succeeded", len(repos))
+			}
+			if err != nil && !strings.Contains(err.Error(), "rate limit") && !strings.Contains(err.Error(), "429") {
+				t.Errorf("Listing beyond the rate limit returned %v, want a rate limit error", err)
+			}
+
+			// The github client refuses requests until the reset of the rate limit, so a new remote is used
+			s.SetRateLimit(-1)
+			r, err = remote.New(f.flavour, s.Provider())
+			if err != nil {
+				t.Fatal(err)
+			}
+			repos, err = r.ListRepos(ctx, nil).All()
+			if err != nil || len(repos) != 120 {
+				t.Errorf("Listing without rate limit returned %d repositories: %v", len(repos), err)
+			}
+		})
+	}
+}
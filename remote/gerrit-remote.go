@@ -0,0 +1,315 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// gerritPerPage is the page size for listings of the gerrit api
+const gerritPerPage = 100
+
+// gerritSSHPort is the default port of the ssh daemon of gerrit
+const gerritSSHPort = 29418
+
+// gerritPrefix is sent in front of every json response of gerrit to prevent XSSI
+const gerritPrefix = ")]}'"
+
+func init() {
+	Register("gerrit", func(p Provider) (Remote, error) { return NewGerritRemote(p) }, Capabilities{
+		Protocols: []string{"ssh", "http"},
+		ListOrder: ListOrderName,
+	})
+}
+
+// GerritRemote implements Remote for Gerrit Code Review.
+// Repositories are gerrit projects, whose names may contain slashes.
+type GerritRemote struct {
+	Provider   Provider
+	HTTPClient *http.Client
+
+	// WebBaseURL is the url of the gerrit server
+	WebBaseURL *url.URL
+
+	rest *restClient
+}
+
+// gerritProject is a project of the gerrit api
+type gerritProject struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Parent   string `json:"parent"`
+	State    string `json:"state"`
+	WebLinks []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"web_links"`
+}
+
+// path returns the api path of the project name
+func (g *GerritRemote) path(name string) string {
+	return "a/projects/" + url.PathEscape(name)
+}
+
+// CreateRepo creates a project with an initial empty commit.
+// Projects inherit their visibility from the parent project, other requested visibilities are refused.
+func (g *GerritRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	if (opts != nil && opts.Visibility != "") || g.Provider.Visibility != "" {
+		return nil, fmt.Errorf("Gerrit projects inherit their visibility from the parent project")
+	}
+
+	body := map[string]interface{}{"create_empty_commit": true}
+	if g.Provider.Parent != "" {
+		body["parent"] = g.Provider.Parent
+	}
+
+	project := new(gerritProject)
+	err := g.rest.do(ctx, "PUT", g.path(name), body, project)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.repository(project), nil
+}
+
+// CloneRepo clones the remote repository and installs the commit-msg hook of the server,
+// which adds the Change-Id to commit messages. A failed hook installation keeps the clone.
+func (g *GerritRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	var endpoint *transport.Endpoint
+
+	project := new(gerritProject)
+	err := g.rest.do(ctx, "GET", g.path(name), nil, project)
+	if err != nil {
+		return err
+	}
+
+	urls := g.repository(project)
+
+	// Define a git endpoint
+	switch g.Provider.CloneProtocol {
+	case "ssh", "":
+		endpoint, err = transport.NewEndpoint(urls.SSHURL)
+	case "http":
+		endpoint, err = transport.NewEndpoint(urls.HTTPURL)
+		if err == nil {
+			endpoint.User, endpoint.Password = g.Provider.User, g.password()
+		}
+	default:
+		err = fmt.Errorf("Unknown clone protocol %s", g.Provider.CloneProtocol)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := sshAuth(g.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	err = cloneEndpoint(ctx, endpoint, auth, name, opts)
+	if err != nil {
+		return err
+	}
+
+	// The clone is kept, only the hook is missing
+	err = g.installHook(ctx, opts.dir(name))
+	if err != nil {
+		return fmt.Errorf("Cloned %s, but could not install the commit-msg hook: %s", name, err)
+	}
+
+	return nil
+}
+
+// installHook installs the commit-msg hook of the server into the repository in dir
+func (g *GerritRemote) installHook(ctx context.Context, dir string) error {
+
+	req, err := http.NewRequest("GET", g.rest.url("tools/hooks/commit-msg"), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := g.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("Download failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Download failed: %s", resp.Status)
+	}
+
+	hook, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Download failed: %s", err)
+	}
+
+	hooks := filepath.Join(dir, ".git", "hooks")
+	err = os.MkdirAll(hooks, 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(hooks, "commit-msg"), hook, 0755)
+}
+
+// DeleteRepo deletes a project, which needs the delete-project plugin on the server
+func (g *GerritRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	err := g.rest.do(ctx, "POST", g.path(name)+"/delete-project~delete", map[string]bool{"force": false}, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("The project does not exist or the delete-project plugin is missing: %s", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos lists the code projects, whose names start with the owner, or all of them.
+// Gerrit has no last update of projects, they are sorted by name.
+func (g *GerritRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	owner := opts.owner()
+	if owner == "" {
+		owner = g.Provider.Owner
+	}
+
+	return NewRepoIterator(ctx, opts, gerritPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		query := url.Values{}
+		query.Set("type", "CODE")
+		query.Set("n", fmt.Sprint(perPage))
+		query.Set("S", fmt.Sprint((page-1)*perPage))
+		if owner != "" {
+			query.Set("p", strings.TrimSuffix(owner, "/")+"/")
+		}
+
+		// Projects are returned as map by name
+		projects := map[string]*gerritProject{}
+		err := g.rest.do(ctx, "GET", "a/projects/?"+query.Encode(), nil, &projects)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		names := make([]string, 0, len(projects))
+		for name := range projects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		repos := make([]*Repository, 0, len(names))
+		for _, name := range names {
+			projects[name].Name = name
+			repos = append(repos, g.repository(projects[name]))
+		}
+
+		// A page which is not full is the last one
+		next := page + 1
+		if len(projects) < perPage {
+			next = 0
+		}
+
+		return repos, next, nil
+	})
+}
+
+// password returns the http password of the user, which may be configured as password or token
+func (g *GerritRemote) password() string {
+	if g.Provider.Token != "" {
+		return g.Provider.Token
+	}
+	return g.Provider.Password
+}
+
+// repository converts a gerrit project into a Repository, the urls are derived from the web base url
+func (g *GerritRemote) repository(p *gerritProject) *Repository {
+
+	_, name := splitName(p.Name)
+	base := fmt.Sprintf("%s://%s%s", g.WebBaseURL.Scheme, g.WebBaseURL.Host, strings.TrimSuffix(g.WebBaseURL.Path, "/"))
+
+	user := ""
+	if g.Provider.User != "" {
+		user = g.Provider.User + "@"
+	}
+
+	repo := &Repository{
+		Name:          name,
+		FullName:      p.Name,
+		DefaultBranch: "master",
+		SSHURL:        fmt.Sprintf("ssh://%s%s:%d/%s", user, g.WebBaseURL.Hostname(), gerritSSHPort, p.Name),
+		HTTPURL:       fmt.Sprintf("%s/a/%s", base, p.Name),
+		WebURL:        fmt.Sprintf("%s/admin/repos/%s", base, url.PathEscape(p.Name)),
+		Archived:      p.State == "READ_ONLY",
+	}
+
+	// Prefer the links of a code browser like gitiles
+	if len(p.WebLinks) > 0 {
+		link, err := g.WebBaseURL.Parse(p.WebLinks[0].URL)
+		if err == nil {
+			repo.WebURL = link.String()
+		}
+	}
+
+	return repo
+}
+
+// NewGerritRemote creates a new Remote object and returns it.
+// Requests are authenticated with the user and the http password of the user.
+func NewGerritRemote(p Provider) (*GerritRemote, error) {
+
+	var err error
+
+	if p.HostBaseURL == "" {
+		return nil, fmt.Errorf("No host_base_url configured for gerrit")
+	}
+
+	remote := new(GerritRemote)
+
+	if p.Type == "" {
+		p.Type = "gerrit"
+	}
+
+	remote.WebBaseURL, err = url.Parse(strings.TrimSuffix(p.HostBaseURL, "/") + "/")
+	if err != nil || remote.WebBaseURL.Host == "" {
+		return nil, fmt.Errorf("Invalid host base url %s", p.HostBaseURL)
+	}
+
+	remote.Provider = p
+	remote.HTTPClient = new(http.Client)
+	remote.rest = &restClient{
+		baseURL:    p.HostBaseURL,
+		httpClient: remote.HTTPClient,
+		prefix:     gerritPrefix,
+		authorize: func(req *http.Request) {
+			req.SetBasicAuth(p.User, remote.password())
+		},
+	}
+
+	return remote, nil
+}
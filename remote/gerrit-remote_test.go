@@ -0,0 +1,368 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// gerritHook is the commit-msg hook served by the stand-in
+const gerritHook = "#!/bin/sh\n# Adds a Change-Id\n"
+
+// gerritStandIn is a local stand-in of the gerrit api for the projects of alice.
+// Responses have the XSSI prefix of gerrit, projects are bare repositories served by git http-backend.
+type gerritStandIn struct {
+	server *httptest.Server
+	dir    string
+
+	mu       sync.Mutex
+	projects map[string]bool
+	bodies   []map[string]interface{}
+	lists    []string
+	hookFail bool
+}
+
+// newGerritStandIn starts a stand-in with a temporary directory for the repositories, both are removed at the end of the test
+func newGerritStandIn(t *testing.T) *gerritStandIn {
+
+	dir, err := ioutil.TempDir("", "gitrc-gerrit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &gerritStandIn{dir: dir, projects: make(map[string]bool)}
+	backend := &cgi.Handler{
+		Path: filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend"),
+		Root: "/a",
+		Env:  []string{"GIT_PROJECT_ROOT=" + dir, "GIT_HTTP_EXPORT_ALL=1"},
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path == "/tools/hooks/commit-msg" {
+			s.serveHook(w)
+			return
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "alice" || password != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/a/projects/") {
+			s.serveProjects(w, r, strings.TrimPrefix(r.URL.EscapedPath(), "/a/projects/"))
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// remote returns a GerritRemote of alice using the stand-in, which clones over http
+func (s *gerritStandIn) remote(t *testing.T) *GerritRemote {
+
+	r, err := NewGerritRemote(Provider{HostBaseURL: s.server.URL, User: "alice", Password: "secret", CloneProtocol: "http"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+// serveHook serves the commit-msg hook, which does not need authentication
+func (s *gerritStandIn) serveHook(w http.ResponseWriter) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hookFail {
+		http.Error(w, "Hook not available", http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(gerritHook))
+}
+
+// writeJSON writes v with the XSSI prefix
+func (s *gerritStandIn) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", gerritPrefix)
+	json.NewEncoder(w).Encode(v)
+}
+
+// project returns the project info of name
+func (s *gerritStandIn) project(name string) map[string]string {
+	return map[string]string{"id": url.PathEscape(name), "name": name, "parent": "All-Projects", "state": "ACTIVE"}
+}
+
+// serveProjects answers requests of the projects api, path is the escaped path after /a/projects/
+func (s *gerritStandIn) serveProjects(w http.ResponseWriter, r *http.Request, path string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if path == "" && r.Method == "GET" {
+		s.list(w, r.URL.Query())
+		return
+	}
+
+	action := ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		path, action = path[:i], path[i+1:]
+	}
+	name, err := url.PathUnescape(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == "PUT":
+		if s.projects[name] {
+			http.Error(w, "Project Already Exists", http.StatusConflict)
+			return
+		}
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.bodies = append(s.bodies, body)
+		if err := s.create(name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		s.writeJSON(w, s.project(name))
+	case !s.projects[name]:
+		http.Error(w, fmt.Sprintf("Not found: %s", name), http.StatusNotFound)
+	case action == "" && r.Method == "GET":
+		s.writeJSON(w, s.project(name))
+	case action == "delete-project~delete" && r.Method == "POST":
+		delete(s.projects, name)
+		os.RemoveAll(filepath.Join(s.dir, name))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// create creates the bare repository of the project name with an empty initial commit
+func (s *gerritStandIn) create(name string) error {
+
+	dir := filepath.Join(s.dir, name)
+	script := `git init --bare -q "$1" && cd "$1" && git symbolic-ref HEAD refs/heads/master &&
+		git update-ref refs/heads/master "$(git commit-tree -m 'Initial empty repository' 4b825dc642cb6eb9a060e54bf8d69288fbee4904)"`
+	c := exec.Command("sh", "-c", script, "sh", dir)
+	c.Env = append(os.Environ(), "GIT_AUTHOR_NAME=alice", "GIT_AUTHOR_EMAIL=alice@example.com", "GIT_COMMITTER_NAME=alice", "GIT_COMMITTER_EMAIL=alice@example.com")
+	if out, err := c.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, out)
+	}
+
+	s.projects[name] = true
+	return nil
+}
+
+// addProject adds a project without a repository
+func (s *gerritStandIn) addProject(name string) {
+	s.projects[name] = true
+}
+
+// list writes the projects starting with the prefix p as map by name, paged by n and S
+func (s *gerritStandIn) list(w http.ResponseWriter, query url.Values) {
+
+	s.lists = append(s.lists, query.Encode())
+
+	names := []string{}
+	for name := range s.projects {
+		if strings.HasPrefix(name, query.Get("p")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start, _ := strconv.Atoi(query.Get("S"))
+	n, _ := strconv.Atoi(query.Get("n"))
+	if start > len(names) {
+		start = len(names)
+	}
+	end := len(names)
+	if n > 0 && start+n < end {
+		end = start + n
+	}
+
+	projects := map[string]map[string]string{}
+	for _, name := range names[start:end] {
+		p := s.project(name)
+		delete(p, "name")
+		projects[name] = p
+	}
+	s.writeJSON(w, projects)
+}
+
+func TestGerritCreateRepo(t *testing.T) {
+
+	s := newGerritStandIn(t)
+	r := s.remote(t)
+	ctx := context.Background()
+
+	repo, err := r.CreateRepo(ctx, "team/tool", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "team/tool" || repo.HTTPURL != s.server.URL+"/a/team/tool" {
+		t.Errorf("Created %s with the http url %s", repo.FullName, repo.HTTPURL)
+	}
+	if len(s.bodies) != 1 || s.bodies[0]["create_empty_commit"] != true || s.bodies[0]["parent"] != nil {
+		t.Errorf("Project was created with %v, want an empty commit", s.bodies)
+	}
+
+	if _, err = r.CreateRepo(ctx, "team/tool", nil); err == nil || !strings.Contains(err.Error(), "Project Already Exists") {
+		t.Errorf("Creating an existing project returned %v", err)
+	}
+	if _, err = r.CreateRepo(ctx, "public", &CreateOptions{Visibility: VisibilityPublic}); err == nil {
+		t.Errorf("Creating a project with a visibility succeeded")
+	}
+
+	r.Provider.Parent = "Team-Projects"
+	if _, err = r.CreateRepo(ctx, "team/lib", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.bodies) != 2 || s.bodies[1]["parent"] != "Team-Projects" {
+		t.Errorf("Project was created with %v, want the parent Team-Projects", s.bodies[len(s.bodies)-1])
+	}
+}
+
+func TestGerritCloneRepo(t *testing.T) {
+
+	s := newGerritStandIn(t)
+	r := s.remote(t)
+	ctx := context.Background()
+	if _, err := r.CreateRepo(ctx, "team/tool", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "gitrc-clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = r.CloneRepo(ctx, "team/tool", &CloneOptions{Dir: filepath.Join(dir, "tool")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := filepath.Join(dir, "tool", ".git", "hooks", "commit-msg")
+	info, err := os.Stat(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("Hook has the mode %s, want 0755", info.Mode().Perm())
+	}
+	if data, _ := ioutil.ReadFile(hook); string(data) != gerritHook {
+		t.Errorf("Hook is %q, want %q", data, gerritHook)
+	}
+
+	// A failed download of the hook keeps the clone
+	s.hookFail = true
+	err = r.CloneRepo(ctx, "team/tool", &CloneOptions{Dir: filepath.Join(dir, "nohook")})
+	if err == nil || !strings.HasPrefix(err.Error(), "Cloned team/tool, but could not install the commit-msg hook: Download failed: 500") {
+		t.Errorf("Cloning with a failing hook download returned %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "nohook", ".git", "HEAD")); err != nil {
+		t.Errorf("Clone was not kept: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "nohook", ".git", "hooks", "commit-msg")); !os.IsNotExist(err) {
+		t.Errorf("Hook was installed from a failed download")
+	}
+
+	err = r.CloneRepo(ctx, "team/missing", &CloneOptions{Dir: filepath.Join(dir, "missing")})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Cloning a missing project returned %v", err)
+	}
+}
+
+func TestGerritListRepos(t *testing.T) {
+
+	s := newGerritStandIn(t)
+	for i := 0; i < 150; i++ {
+		s.addProject(fmt.Sprintf("team/repo-%03d", i))
+	}
+	s.addProject("other")
+	r := s.remote(t)
+	ctx := context.Background()
+
+	repos, err := r.ListRepos(ctx, &ListOptions{Owner: "team"}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 150 || repos[0].FullName != "team/repo-000" || repos[149].FullName != "team/repo-149" {
+		t.Errorf("Listed %d repositories, want team/repo-000 to team/repo-149", len(repos))
+	}
+	want := "[S=0&n=100&p=team%2F&type=CODE S=100&n=100&p=team%2F&type=CODE]"
+	if fmt.Sprint(s.lists) != want {
+		t.Errorf("Listing requested %v, want %s", s.lists, want)
+	}
+
+	repos, err = r.ListRepos(ctx, nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 151 || repos[0].FullName != "other" {
+		t.Errorf("Listed %d repositories starting with %s, want 151 starting with other", len(repos), repos[0].FullName)
+	}
+}
+
+func TestGerritDeleteRepo(t *testing.T) {
+
+	s := newGerritStandIn(t)
+	s.addProject("team/tool")
+	r := s.remote(t)
+	ctx := context.Background()
+
+	if err := r.DeleteRepo(ctx, "team/tool"); err != nil {
+		t.Fatal(err)
+	}
+	if s.projects["team/tool"] {
+		t.Errorf("Project was not deleted")
+	}
+	err := r.DeleteRepo(ctx, "team/tool")
+	if err == nil || !strings.Contains(err.Error(), "delete-project plugin is missing") {
+		t.Errorf("Deleting a missing project returned %v", err)
+	}
+}
@@ -0,0 +1,513 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"code.gitea.io/sdk/gitea"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// giteaPerPage is the default maximum page size of the gitea api
+const giteaPerPage = 50
+
+// Flavours of the gitea api
+const (
+	FlavourGitea   = "gitea"
+	FlavourForgejo = "forgejo"
+	FlavourGogs    = "gogs"
+)
+
+// codebergURL is the url of Codeberg, the default host of forgejo remotes
+const codebergURL = "https://codeberg.org"
+
+func init() {
+
+	// Gitea and forgejo share the api, gitea has no internal repositories
+	caps := Capabilities{
+		Visibilities: []Visibility{VisibilityPublic, VisibilityPrivate},
+		Protocols:    []string{"ssh", "http"},
+		ListOrder:    ListOrderName,
+	}
+
+	Register("gitea", func(p Provider) (Remote, error) { return NewGiteaRemote(p) }, caps)
+	Register("forgejo", func(p Provider) (Remote, error) { return NewForgejoRemote(p) }, caps)
+
+	// Gogs can neither edit nor fork repositories
+	Register("gogs", func(p Provider) (Remote, error) { return NewGogsRemote(p) }, Capabilities{
+		Visibilities: []Visibility{VisibilityPublic, VisibilityPrivate},
+		Protocols:    []string{"ssh", "http"},
+		ListOrder:    ListOrderName,
+	})
+}
+
+// GiteaRemote implements Remote for Gitea and the servers speaking its api, Forgejo and Gogs
+type GiteaRemote struct {
+	Provider   Provider
+	HTTPClient *http.Client
+
+	// Flavour is the server software, it is detected before the first request
+	Flavour string
+
+	rest        *restClient
+	flavourOnce sync.Once
+	flavourErr  error
+}
+
+// ServerVersion detects the flavour and the version of the server.
+// Gogs has no version endpoint, its version is empty.
+func (g *GiteaRemote) ServerVersion(ctx context.Context) (string, string, error) {
+
+	v := struct {
+		Version string `json:"version"`
+	}{}
+
+	// Only forgejo has its own version endpoint
+	err := g.rest.do(ctx, "GET", "api/forgejo/v1/version", nil, &v)
+	if err == nil {
+		return FlavourForgejo, v.Version, nil
+	}
+	if !isStatus(err, http.StatusNotFound) {
+		return "", "", err
+	}
+
+	err = g.rest.do(ctx, "GET", "api/v1/version", nil, &v)
+	if isStatus(err, http.StatusNotFound) {
+		return FlavourGogs, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	return FlavourGitea, v.Version, nil
+}
+
+// detect detects the flavour of the server once, so the features of the server are known
+func (g *GiteaRemote) detect(ctx context.Context) error {
+
+	g.flavourOnce.Do(func() {
+		flavour, _, err := g.ServerVersion(ctx)
+		if err != nil {
+			g.flavourErr = fmt.Errorf("Could not detect the server version: %s", err)
+			return
+		}
+		g.Flavour = flavour
+	})
+
+	return g.flavourErr
+}
+
+// contextTransport binds all requests to a context.
+// The gitea sdk does not support contexts by itself.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+// RoundTrip executes a single request with the context of the transport
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// client returns a gitea client, whose requests are bound to ctx
+func (g *GiteaRemote) client(ctx context.Context) *gitea.Client {
+
+	base := g.HTTPClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	c := gitea.NewClient(g.Provider.HostBaseURL, g.Provider.Token)
+	c.SetHTTPClient(&http.Client{
+		Transport: &contextTransport{ctx: ctx, base: base},
+		Timeout:   g.HTTPClient.Timeout,
+	})
+
+	return c
+}
+
+// owner returns the owner and the name of a repository given as "owner/name" or "name".
+// Without an owner in name, the configured owner or the user owns the repository.
+func (g *GiteaRemote) owner(name string) (string, string) {
+
+	owner, name := splitName(name)
+	if owner == "" {
+		owner = g.Provider.Owner
+	}
+	if owner == "" {
+		owner = g.Provider.User
+	}
+
+	return owner, name
+}
+
+// isUser checks if owner is the user of the token
+func (g *GiteaRemote) isUser(owner string) bool {
+	return owner == "" || strings.EqualFold(owner, g.Provider.User)
+}
+
+// CreateRepo creates a remote repository, repositories of other owners than the user are created in the organisation
+func (g *GiteaRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	if err := g.detect(ctx); err != nil {
+		return nil, err
+	}
+
+	visibility, err := opts.visibility(g.Provider)
+	if err != nil {
+		return nil, err
+	}
+	private, err := g.private(visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, name := g.owner(name)
+
+	// Create an empty new Repo
+	copts := gitea.CreateRepoOption{
+		Name:     name,
+		Private:  private,
+		Readme:   "Default",
+		AutoInit: true,
+	}
+
+	var repo *gitea.Repository
+	switch {
+	case g.isUser(owner):
+		repo, err = g.client(ctx).CreateRepo(copts)
+	case g.Flavour == FlavourGogs:
+		// Gogs creates the repositories of organisations at /org instead of /orgs
+		repo = new(gitea.Repository)
+		err = g.rest.do(ctx, "POST", fmt.Sprintf("api/v1/org/%s/repos", url.PathEscape(owner)), copts, repo)
+	default:
+		repo, err = g.client(ctx).CreateOrgRepo(owner, copts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// We wait 1 second, just to be sure the repo was created
+	err = sleep(ctx, time.Second*1)
+	if err != nil {
+		return nil, err
+	}
+
+	return giteaRepository(repo), nil
+}
+
+// CloneRepo clones the remote repository
+func (g *GiteaRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	if err := g.detect(ctx); err != nil {
+		return err
+	}
+
+	var endpoint *transport.Endpoint
+
+	repo, err := g.client(ctx).GetRepo(g.owner(name))
+	if err != nil {
+		return err
+	}
+
+	// Define a git endpoint
+	switch g.Provider.CloneProtocol {
+	case "ssh", "":
+		endpoint, err = transport.NewEndpoint(repo.SSHURL)
+	case "http":
+		endpoint, err = transport.NewEndpoint(repo.CloneURL)
+		if err == nil {
+			endpoint.User = g.Provider.User
+			endpoint.Password = g.Provider.Token
+		}
+	default:
+		err = fmt.Errorf("Unknown clone protocol %s", g.Provider.CloneProtocol)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := sshAuth(g.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository
+func (g *GiteaRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	if err := g.detect(ctx); err != nil {
+		return err
+	}
+
+	err := g.client(ctx).DeleteRepo(g.owner(name))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// private maps visibility to the private flag of a gitea repository, gitea has no internal repositories
+func (g *GiteaRemote) private(visibility Visibility) (bool, error) {
+
+	switch visibility {
+	case VisibilityPublic:
+		return false, nil
+	case VisibilityPrivate:
+		return true, nil
+	}
+
+	return false, unsupportedVisibility(g.Provider.Type, visibility)
+}
+
+// SetVisibility changes the visibility of a (remote) repository
+func (g *GiteaRemote) SetVisibility(ctx context.Context, name string, visibility Visibility) error {
+
+	private, err := g.private(visibility)
+	if err != nil {
+		return err
+	}
+
+	return g.edit(ctx, name, "Changing the visibility", gitea.EditRepoOption{Private: &private})
+}
+
+// edit changes the settings of a (remote) repository, gogs can't edit repositories
+func (g *GiteaRemote) edit(ctx context.Context, name, change string, eopts gitea.EditRepoOption) error {
+
+	if err := g.detect(ctx); err != nil {
+		return err
+	}
+
+	if g.Flavour == FlavourGogs {
+		return fmt.Errorf("%s is not supported by %s", change, FlavourGogs)
+	}
+
+	owner, name := g.owner(name)
+	_, err := g.client(ctx).EditRepo(owner, name, eopts)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ArchiveRepo archives or unarchives a (remote) repository
+func (g *GiteaRemote) ArchiveRepo(ctx context.Context, name string, archived bool) error {
+	return g.edit(ctx, name, "Archiving", gitea.EditRepoOption{Archived: &archived})
+}
+
+// RenameRepo renames a (remote) repository
+func (g *GiteaRemote) RenameRepo(ctx context.Context, name, newName string) error {
+
+	err := checkNewName(newName)
+	if err != nil {
+		return err
+	}
+
+	return g.edit(ctx, name, "Renaming", gitea.EditRepoOption{Name: &newName})
+}
+
+// ForkRepo forks a (remote) repository to the user or into the organisation owner
+func (g *GiteaRemote) ForkRepo(ctx context.Context, name, owner string) (*Repository, error) {
+
+	if err := g.detect(ctx); err != nil {
+		return nil, err
+	}
+	if g.Flavour == FlavourGogs {
+		return nil, fmt.Errorf("Forking is not supported by %s", FlavourGogs)
+	}
+
+	fopts := gitea.CreateForkOption{}
+	if !g.isUser(owner) {
+		fopts.Organization = &owner
+	}
+
+	from, name := g.owner(name)
+	fork, err := g.client(ctx).CreateFork(from, name, fopts)
+	if err != nil {
+		return nil, err
+	}
+
+	return giteaRepository(fork), nil
+}
+
+// ListRepos lists the repos of the user, another user or an organisation sorted by name
+func (g *GiteaRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	if err := g.detect(ctx); err != nil {
+		return errorIterator(err)
+	}
+
+	owner := opts.owner()
+	if owner == "" {
+		owner = g.Provider.Owner
+	}
+
+	// The repositories of the token user include private ones, owners, which are no organisation, are users
+	path := "/user/repos"
+	if !g.isUser(owner) {
+		err := g.rest.do(ctx, "GET", fmt.Sprintf("api/v1/orgs/%s", url.PathEscape(owner)), nil, nil)
+		switch {
+		case err == nil:
+			path = fmt.Sprintf("/orgs/%s/repos", url.PathEscape(owner))
+		case isStatus(err, http.StatusNotFound):
+			path = fmt.Sprintf("/users/%s/repos", url.PathEscape(owner))
+		default:
+			return errorIterator(fmt.Errorf("Could not look up the owner %s: %s", owner, err))
+		}
+	}
+
+	// The api lists in no defined order
+	return NewRepoIterator(ctx, opts, giteaPerPage, sortByName(giteaPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		// The gitea sdk can't page, so we call the api ourselves
+		var repositories []*gitea.Repository
+		err := g.rest.do(ctx, "GET", fmt.Sprintf("api/v1%s?page=%d&limit=%d", path, page, perPage), nil, &repositories)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		repos := make([]*Repository, 0, len(repositories))
+		for _, r := range repositories {
+			repos = append(repos, giteaRepository(r))
+		}
+
+		// The server may return less than perPage repositories, if its MAX_RESPONSE_ITEMS is smaller,
+		// so only an empty page is the last one.
+		// Gogs doesn't page at all and returns all repositories at once.
+		next := page + 1
+		if len(repositories) == 0 || g.Flavour == FlavourGogs {
+			next = 0
+		}
+
+		return repos, next, nil
+	}))
+}
+
+// giteaRepository converts a gitea repository into a Repository
+func giteaRepository(r *gitea.Repository) *Repository {
+
+	visibility := VisibilityPublic
+	if r.Private {
+		visibility = VisibilityPrivate
+	}
+
+	return &Repository{
+		Name:          r.Name,
+		FullName:      r.FullName,
+		Visibility:    visibility,
+		DefaultBranch: r.DefaultBranch,
+		SSHURL:        r.SSHURL,
+		HTTPURL:       r.CloneURL,
+		WebURL:        r.HTMLURL,
+		Created:       r.Created,
+		Updated:       r.Updated,
+		Archived:      r.Archived,
+		Size:          int64(r.Size),
+	}
+}
+
+// NewGiteaRemote creates a new Remote object and returns it
+func NewGiteaRemote(p Provider) (*GiteaRemote, error) {
+
+	if p.Type == "" {
+		p.Type = "gitea"
+	}
+	if p.HostBaseURL == "" {
+		return nil, fmt.Errorf("No host_base_url configured for %s", p.Type)
+	}
+
+	remote := new(GiteaRemote)
+
+	remote.Provider = p
+	remote.HTTPClient = new(http.Client)
+	remote.rest = &restClient{
+		baseURL:    p.HostBaseURL,
+		httpClient: remote.HTTPClient,
+		authorize: func(req *http.Request) {
+			if p.Token != "" {
+				req.Header.Set("Authorization", "token "+p.Token)
+			}
+		},
+	}
+
+	return remote, nil
+}
+
+// NewForgejoRemote creates a Remote for Forgejo, host_base_url defaults to Codeberg
+func NewForgejoRemote(p Provider) (*GiteaRemote, error) {
+
+	if p.Type == "" {
+		p.Type = "forgejo"
+	}
+	if p.HostBaseURL == "" {
+		p.HostBaseURL = codebergURL
+	}
+
+	return NewGiteaRemote(p)
+}
+
+// GogsRemote implements Remote for Gogs.
+// Gogs speaks an older version of the gitea api, so only the methods of Remote are available.
+type GogsRemote struct {
+	Gitea *GiteaRemote
+}
+
+// CreateRepo creates a remote repository, repositories of other owners than the user are created in the organisation
+func (g *GogsRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+	return g.Gitea.CreateRepo(ctx, name, opts)
+}
+
+// CloneRepo clones the remote repository
+func (g *GogsRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+	return g.Gitea.CloneRepo(ctx, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository
+func (g *GogsRemote) DeleteRepo(ctx context.Context, name string) error {
+	return g.Gitea.DeleteRepo(ctx, name)
+}
+
+// ListRepos lists the repos of the user, another user or an organisation sorted by name
+func (g *GogsRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+	return g.Gitea.ListRepos(ctx, opts)
+}
+
+// NewGogsRemote creates a Remote for Gogs
+func NewGogsRemote(p Provider) (*GogsRemote, error) {
+
+	if p.Type == "" {
+		p.Type = "gogs"
+	}
+
+	remote, err := NewGiteaRemote(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GogsRemote{Gitea: remote}, nil
+}
@@ -0,0 +1,76 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGogs(t *testing.T) {
+
+	// Gogs has no version endpoint and creates the repositories of organisations at /org
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method != "POST" || r.URL.Path != "/api/v1/org/acme/repos" {
+			http.NotFound(w, r)
+			return
+		}
+		body := struct {
+			Name     string `json:"name"`
+			AutoInit bool   `json:"auto_init"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": body.Name, "full_name": "acme/" + body.Name, "private": true})
+	}))
+	defer server.Close()
+
+	r, err := New("gogs", Provider{Type: "gogs", HostBaseURL: server.URL, User: "alice", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := FeaturesOf(r); f != (Features{}) {
+		t.Errorf("Gogs remotes have the features %+v, want none", f)
+	}
+
+	repo, err := r.CreateRepo(context.Background(), "acme/tool", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "acme/tool" || repo.Visibility != VisibilityPrivate {
+		t.Errorf("Created %s with the visibility %s, want a private acme/tool", repo.FullName, repo.Visibility)
+	}
+
+	// A gitea remote talking to gogs refuses to fork
+	g := r.(*GogsRemote).Gitea
+	_, err = g.ForkRepo(context.Background(), "acme/tool", "")
+	if err == nil || !strings.Contains(err.Error(), "not supported by gogs") {
+		t.Errorf("Forking on gogs returned %v, want an unsupported error", err)
+	}
+	for _, req := range requests {
+		if strings.Contains(req, "/forks") || strings.Contains(req, "/orgs/") {
+			t.Errorf("Unexpected request %s", req)
+		}
+	}
+}
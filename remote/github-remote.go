@@ -0,0 +1,573 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+
+	"github.com/google/go-github/github"
+	version "github.com/hashicorp/go-version"
+	"golang.org/x/oauth2"
+)
+
+// githubPerPage is the maximum page size of the github api
+const githubPerPage = 100
+
+// githubMinEnterpriseVersion is the oldest supported version of GitHub Enterprise Server
+const githubMinEnterpriseVersion = "2.20.0"
+
+func init() {
+	Register("github", func(p Provider) (Remote, error) { return NewGithubRemote(p) }, Capabilities{
+		Visibilities: Visibilities,
+		Protocols:    []string{"ssh", "http"},
+		ListTypes:    []string{"all", "owner", "public", "private", "forks", "sources", "member"},
+		ListOrder:    ListOrderUpdated,
+	})
+}
+
+// GithubRemote implements Remote
+type GithubRemote struct {
+	Provider     Provider
+	GithubClient *github.Client
+	oauthclient  *http.Client
+
+	// Enterprise is set for GitHub Enterprise Server instances
+	Enterprise bool
+	// WebBaseURL is the URL of the web interface, e.g. https://github.com
+	WebBaseURL *url.URL
+
+	versionMu      sync.Mutex
+	versionChecked bool
+}
+
+// ServerVersion returns the installed version of a GitHub Enterprise Server.
+// It returns an empty version for github.com.
+func (g *GithubRemote) ServerVersion(ctx context.Context) (string, error) {
+
+	if !g.Enterprise {
+		return "", nil
+	}
+
+	req, err := g.GithubClient.NewRequest("GET", "meta", nil)
+	if err != nil {
+		return "", err
+	}
+
+	meta := struct {
+		InstalledVersion string `json:"installed_version"`
+	}{}
+	resp, err := g.GithubClient.Do(ctx, req, &meta)
+	if err != nil {
+		return "", err
+	}
+
+	// Older servers only send the version as header
+	if meta.InstalledVersion == "" {
+		meta.InstalledVersion = resp.Header.Get("X-GitHub-Enterprise-Version")
+	}
+	if meta.InstalledVersion == "" {
+		return "", fmt.Errorf("%s does not report a GitHub Enterprise Server version", g.GithubClient.BaseURL)
+	}
+
+	return meta.InstalledVersion, nil
+}
+
+// checkVersion verifies, that a GitHub Enterprise Server is recent enough.
+// Only a successful check is remembered, after an error the version is checked again.
+func (g *GithubRemote) checkVersion(ctx context.Context) error {
+
+	g.versionMu.Lock()
+	defer g.versionMu.Unlock()
+
+	if g.versionChecked {
+		return nil
+	}
+
+	v, err := g.ServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if v != "" {
+		installed, err := version.NewVersion(v)
+		if err != nil {
+			return fmt.Errorf("Invalid GitHub Enterprise Server version %s: %s", v, err)
+		}
+		if installed.LessThan(version.Must(version.NewVersion(githubMinEnterpriseVersion))) {
+			return fmt.Errorf("GitHub Enterprise Server %s is not supported, at least %s is needed", v, githubMinEnterpriseVersion)
+		}
+	}
+	g.versionChecked = true
+
+	return nil
+}
+
+// repository converts a github repository into a Repository.
+// Missing URLs are derived from the web base url.
+func (g *GithubRemote) repository(r *githubRepo) *Repository {
+
+	repo := githubRepository(r)
+
+	web := fmt.Sprintf("%s://%s/%s", g.WebBaseURL.Scheme, g.WebBaseURL.Host, repo.FullName)
+	if repo.WebURL == "" {
+		repo.WebURL = web
+	}
+	if repo.HTTPURL == "" {
+		repo.HTTPURL = web + ".git"
+	}
+	if repo.SSHURL == "" {
+		repo.SSHURL = fmt.Sprintf("git@%s:%s.git", g.WebBaseURL.Hostname(), repo.FullName)
+	}
+
+	return repo
+}
+
+// owner returns the owner and the name of a repository given as "owner/name" or "name".
+// Without an owner in name, the configured owner or the user owns the repository.
+func (g *GithubRemote) owner(name string) (string, string) {
+
+	owner, name := splitName(name)
+	if owner == "" {
+		owner = g.Provider.Owner
+	}
+	if owner == "" {
+		owner = g.Provider.User
+	}
+
+	return owner, name
+}
+
+// isUser checks if owner is the authenticated user
+func (g *GithubRemote) isUser(owner string) bool {
+	return owner == "" || strings.EqualFold(owner, g.Provider.User)
+}
+
+// CreateRepo creates a remote repository, repositories of other owners than the user are created in the organisation
+func (g *GithubRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	err := g.checkVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	visibility, err := opts.visibility(g.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, name := g.owner(name)
+	path := fmt.Sprintf("orgs/%s/repos", owner)
+	if g.isUser(owner) {
+		if visibility == VisibilityInternal {
+			return nil, fmt.Errorf("Internal repositories can only be created in organisations")
+		}
+		path = "user/repos"
+	}
+
+	// Create repo
+	repo, err := g.repoRequest(ctx, "POST", path, name, visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	// We wait 1 second, just to be sure the repo was created
+	err = sleep(ctx, time.Second*1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a basic README
+	opt := new(github.RepositoryContentFileOptions)
+	opt.Content = []byte(fmt.Sprintf("# %s", repo.GetName()))
+	opt.Message = func(s string) *string { return &s }("Added a README")
+
+	if login := repo.GetOwner().GetLogin(); login != "" {
+		owner = login
+	}
+	_, _, err = g.GithubClient.Repositories.CreateFile(ctx, owner, name, "README.md", opt)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.repository(repo), nil
+}
+
+// githubRepoRequest is the body of create and edit requests for repositories.
+// It contains the visibility, which the github client does not know yet.
+type githubRepoRequest struct {
+	Name       string `json:"name,omitempty"`
+	Private    *bool  `json:"private,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// githubRepo is a github repository with its visibility, which the github client does not know yet
+type githubRepo struct {
+	github.Repository
+	Visibility string `json:"visibility"`
+}
+
+// repoRequest sends a create or edit request with the given visibility for a repository
+func (g *GithubRemote) repoRequest(ctx context.Context, method, path, name string, visibility Visibility) (*githubRepo, error) {
+
+	body := &githubRepoRequest{Name: name}
+	switch visibility {
+	case VisibilityPublic, VisibilityPrivate:
+		private := visibility == VisibilityPrivate
+		body.Private = &private
+	case VisibilityInternal:
+		body.Visibility = string(visibility)
+	default:
+		return nil, unsupportedVisibility(g.Provider.Type, visibility)
+	}
+
+	req, err := g.GithubClient.NewRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	// Internal repositories are still a preview of the api
+	if visibility == VisibilityInternal {
+		req.Header.Set("Accept", "application/vnd.github.nebula-preview+json")
+	}
+
+	repo := new(githubRepo)
+	_, err = g.GithubClient.Do(ctx, req, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// SetVisibility changes the visibility of a (remote) repository, only repositories of organisations can be internal
+func (g *GithubRemote) SetVisibility(ctx context.Context, name string, visibility Visibility) error {
+
+	err := g.checkVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	owner, name := g.owner(name)
+	_, err = g.repoRequest(ctx, "PATCH", fmt.Sprintf("repos/%s/%s", owner, name), "", visibility)
+
+	return err
+}
+
+// ArchiveRepo archives or unarchives a (remote) repository
+func (g *GithubRemote) ArchiveRepo(ctx context.Context, name string, archived bool) error {
+
+	err := g.checkVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	owner, name := g.owner(name)
+	_, _, err = g.GithubClient.Repositories.Edit(ctx, owner, name, &github.Repository{Archived: &archived})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RenameRepo renames a (remote) repository, github redirects the old name to the new one
+func (g *GithubRemote) RenameRepo(ctx context.Context, name, newName string) error {
+
+	err := checkNewName(newName)
+	if err != nil {
+		return err
+	}
+
+	err = g.checkVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	owner, name := g.owner(name)
+	_, _, err = g.GithubClient.Repositories.Edit(ctx, owner, name, &github.Repository{Name: &newName})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ForkRepo forks a (remote) repository to the user or into the organisation owner.
+// github creates forks in the background, so the fork may not be complete yet.
+func (g *GithubRemote) ForkRepo(ctx context.Context, name, owner string) (*Repository, error) {
+
+	err := g.checkVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opt := new(github.RepositoryCreateForkOptions)
+	if !g.isUser(owner) {
+		opt.Organization = owner
+	}
+
+	from, name := g.owner(name)
+	fork, _, err := g.GithubClient.Repositories.CreateFork(ctx, from, name, opt)
+	if _, ok := err.(*github.AcceptedError); ok {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return g.repository(&githubRepo{Repository: *fork}), nil
+}
+
+// CloneRepo clones the remote repository
+func (g *GithubRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	var endpoint *transport.Endpoint
+
+	err := g.checkVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	owner, repoName := g.owner(name)
+	repo, _, err := g.GithubClient.Repositories.Get(ctx, owner, repoName)
+	if err != nil {
+		return err
+	}
+
+	urls := g.repository(&githubRepo{Repository: *repo})
+
+	// Define a git endpoint
+	switch g.Provider.CloneProtocol {
+	case "ssh", "":
+		endpoint, err = transport.NewEndpoint(urls.SSHURL)
+	case "http":
+		endpoint, err = transport.NewEndpoint(urls.HTTPURL)
+		if err == nil {
+			endpoint.User = g.Provider.User
+			endpoint.Password = g.Provider.Password
+		}
+	default:
+		err = fmt.Errorf("Unknown clone protocol %s", g.Provider.CloneProtocol)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := sshAuth(g.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository
+func (g *GithubRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	err := g.checkVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	owner, name := g.owner(name)
+	_, err = g.GithubClient.Repositories.Delete(ctx, owner, name)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos lists the repos of the user, another user or an organisation.
+// The most recently updated repositories come first.
+// Organisation listings can be filtered by the types all, public, private, forks, sources and member,
+// listings of the user by the types all, owner, public, private and member.
+func (g *GithubRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	err := g.checkVersion(ctx)
+	if err != nil {
+		return errorIterator(err)
+	}
+
+	owner := opts.owner()
+	if owner == "" {
+		owner = g.Provider.Owner
+	}
+
+	// Repositories of the authenticated user, including private ones
+	if g.isUser(owner) {
+		return g.listRepos(ctx, opts, "", "owner")
+	}
+
+	user, _, err := g.GithubClient.Users.Get(ctx, owner)
+	if err != nil {
+		return errorIterator(err)
+	}
+	if user.GetType() != "Organization" {
+		return g.listRepos(ctx, opts, owner, "owner")
+	}
+
+	typ := opts.typ()
+	if typ == "" {
+		typ = "all"
+	}
+	switch typ {
+	case "all", "public", "private", "forks", "sources", "member":
+	default:
+		return errorIterator(fmt.Errorf("Unknown repository type %s, type can be one of: all, public, private, forks, sources, member", typ))
+	}
+
+	return NewRepoIterator(ctx, opts, githubPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		return g.listPage(ctx, fmt.Sprintf("orgs/%s/repos", url.PathEscape(owner)), typ, page, perPage)
+	})
+}
+
+// listRepos lists the repos of user, which is the authenticated user, if empty
+func (g *GithubRemote) listRepos(ctx context.Context, opts *ListOptions, user, defaultType string) *RepoIterator {
+
+	typ := opts.typ()
+	if typ == "" {
+		typ = defaultType
+	}
+	switch typ {
+	case "all", "owner", "public", "private", "member":
+	default:
+		return errorIterator(fmt.Errorf("Unknown repository type %s, type can be one of: all, owner, public, private, member", typ))
+	}
+
+	path := "user/repos"
+	if user != "" {
+		path = fmt.Sprintf("users/%s/repos", url.PathEscape(user))
+	}
+
+	return NewRepoIterator(ctx, opts, githubPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+		return g.listPage(ctx, path, typ, page, perPage)
+	})
+}
+
+// listPage fetches a page of the repositories at path, the most recently updated first.
+// The github client can neither sort the repositories of organisations nor does it know the visibility.
+func (g *GithubRemote) listPage(ctx context.Context, path, typ string, page, perPage int) ([]*Repository, int, error) {
+
+	query := url.Values{}
+	query.Set("type", typ)
+	query.Set("sort", "updated")
+	query.Set("page", fmt.Sprint(page))
+	query.Set("per_page", fmt.Sprint(perPage))
+
+	req, err := g.GithubClient.NewRequest("GET", path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Internal repositories are still a preview of the api
+	req.Header.Set("Accept", "application/vnd.github.nebula-preview+json")
+
+	var repositories []*githubRepo
+	resp, err := g.GithubClient.Do(ctx, req, &repositories)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	repos := make([]*Repository, 0, len(repositories))
+	for _, r := range repositories {
+		repos = append(repos, g.repository(r))
+	}
+
+	return repos, resp.NextPage, nil
+}
+
+// githubRepository converts a github repository into a Repository
+func githubRepository(r *githubRepo) *Repository {
+
+	visibility := VisibilityPublic
+	if r.Visibility == string(VisibilityInternal) {
+		visibility = VisibilityInternal
+	} else if r.GetPrivate() {
+		visibility = VisibilityPrivate
+	}
+
+	return &Repository{
+		Name:          r.GetName(),
+		FullName:      r.GetFullName(),
+		Visibility:    visibility,
+		DefaultBranch: r.GetDefaultBranch(),
+		SSHURL:        r.GetSSHURL(),
+		HTTPURL:       r.GetCloneURL(),
+		WebURL:        r.GetHTMLURL(),
+		Created:       r.GetCreatedAt().Time,
+		Updated:       r.GetUpdatedAt().Time,
+		Archived:      r.GetArchived(),
+		Size:          int64(r.GetSize()),
+	}
+}
+
+// NewGithubRemote creates a new Remote object and returns it.
+// If the host base url is not github.com, a GitHub Enterprise Server is used.
+func NewGithubRemote(p Provider) (*GithubRemote, error) {
+
+	var err error
+
+	remote := new(GithubRemote)
+
+	if p.Type == "" {
+		p.Type = "github"
+	}
+	remote.Provider = p
+	// Create an oauth client
+	token := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: p.Token})
+	remote.oauthclient = oauth2.NewClient(context.Background(), token)
+
+	remote.WebBaseURL, err = url.Parse(p.HostBaseURL)
+	if err != nil || (p.HostBaseURL != "" && remote.WebBaseURL.Host == "") {
+		return nil, fmt.Errorf("Invalid host base url %s", p.HostBaseURL)
+	}
+
+	switch remote.WebBaseURL.Host {
+	case "", "github.com", "api.github.com":
+		// Create Github Client
+		remote.GithubClient = github.NewClient(remote.oauthclient)
+		remote.WebBaseURL, _ = url.Parse("https://github.com")
+		return remote, nil
+	}
+
+	// GitHub Enterprise Server serves the api below /api/v3 and uploads below /api/uploads
+	host := fmt.Sprintf("%s://%s", remote.WebBaseURL.Scheme, remote.WebBaseURL.Host)
+	baseURL := p.HostBaseURL
+	if !strings.Contains(remote.WebBaseURL.Path, "/api/") {
+		baseURL = host + "/api/v3/"
+	}
+	uploadURL := p.UploadURL
+	if uploadURL == "" {
+		uploadURL = host + "/api/uploads/"
+	}
+
+	remote.Enterprise = true
+	remote.WebBaseURL.Path = ""
+	remote.GithubClient, err = github.NewEnterpriseClient(baseURL, uploadURL, remote.oauthclient)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create GitHub Enterprise client for %s: %s", baseURL, err)
+	}
+
+	return remote, nil
+}
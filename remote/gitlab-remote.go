@@ -0,0 +1,355 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gitlab "github.com/xanzy/go-gitlab"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// gitlabPerPage is the maximum page size of the gitlab api
+const gitlabPerPage = 100
+
+func init() {
+	Register("gitlab", func(p Provider) (Remote, error) { return NewGitlabRemote(p) }, Capabilities{
+		Visibilities: Visibilities,
+		Protocols:    []string{"ssh", "http"},
+		Subgroups:    true,
+		ListOrder:    ListOrderUpdated,
+	})
+}
+
+// GitlabRemote object
+type GitlabRemote struct {
+	Provider     Provider
+	GitlabClient *gitlab.Client
+}
+
+// namespace looks up a user or group namespace by its full path, e.g. platform/backend/services
+func (g *GitlabRemote) namespace(ctx context.Context, path string) (*gitlab.Namespace, error) {
+
+	// The namespace api does not escape the path itself
+	ns, _, err := g.GitlabClient.Namespaces.GetNamespace(url.PathEscape(path), gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("Could not find namespace %s: %s", path, err)
+	}
+
+	return ns, nil
+}
+
+// CreateRepo creates a remote repository
+func (g *GitlabRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	// GitLab knows all visibilities
+	visibility, err := opts.visibility(g.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// We need to fetch the namespace id from the namespace path
+	path, name := splitName(g.path(name))
+	ns, err := g.namespace(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// We create a new repository
+	popts := new(gitlab.CreateProjectOptions)
+	popts.Name = &name
+	popts.Visibility = gitlab.Visibility(gitlab.VisibilityValue(visibility))
+	popts.NamespaceID = &ns.ID
+	project, _, err := g.GitlabClient.Projects.CreateProject(popts, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	// We wait 1 second, just to be sure the repo was created
+	err = sleep(ctx, time.Second*1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a basic README.md
+	readmecontent := fmt.Sprintf("# %s\n", name)
+	commitmsg := "Adding a README\n"
+	cfopts := new(gitlab.CreateFileOptions)
+	cfopts.Branch = gitlab.String("master")
+	cfopts.Content = &readmecontent
+	cfopts.CommitMessage = &commitmsg
+	_, _, err = g.GitlabClient.RepositoryFiles.CreateFile(project.ID, "README.md", cfopts, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return gitlabRepository(project), nil
+}
+
+// CloneRepo clones the remote repository
+func (g *GitlabRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	var endpoint *transport.Endpoint
+
+	project, _, err := g.GitlabClient.Projects.GetProject(g.path(name), nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	// Define a git endpoint
+	switch g.Provider.CloneProtocol {
+	case "ssh", "":
+		endpoint, err = transport.NewEndpoint(project.SSHURLToRepo)
+	case "http":
+		endpoint, err = transport.NewEndpoint(project.HTTPURLToRepo)
+		if err == nil {
+			endpoint.User = g.Provider.User
+			endpoint.Password = g.Provider.Password
+		}
+	default:
+		err = fmt.Errorf("Unknown clone protocol %s", g.Provider.CloneProtocol)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := sshAuth(g.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository
+func (g *GitlabRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	// Projects can be deleted by their path with namespace
+	_, err := g.GitlabClient.Projects.DeleteProject(g.path(name), gitlab.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetVisibility changes the visibility of a (remote) repository
+func (g *GitlabRemote) SetVisibility(ctx context.Context, name string, visibility Visibility) error {
+
+	eopts := new(gitlab.EditProjectOptions)
+	eopts.Visibility = gitlab.Visibility(gitlab.VisibilityValue(visibility))
+
+	_, _, err := g.GitlabClient.Projects.EditProject(g.path(name), eopts, gitlab.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ArchiveRepo archives or unarchives a (remote) repository
+func (g *GitlabRemote) ArchiveRepo(ctx context.Context, name string, archived bool) error {
+
+	var err error
+	if archived {
+		_, _, err = g.GitlabClient.Projects.ArchiveProject(g.path(name), gitlab.WithContext(ctx))
+	} else {
+		_, _, err = g.GitlabClient.Projects.UnarchiveProject(g.path(name), gitlab.WithContext(ctx))
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RenameRepo renames a (remote) repository, the name and the path of the project are changed
+func (g *GitlabRemote) RenameRepo(ctx context.Context, name, newName string) error {
+
+	err := checkNewName(newName)
+	if err != nil {
+		return err
+	}
+
+	eopts := new(gitlab.EditProjectOptions)
+	eopts.Name = &newName
+	eopts.Path = &newName
+
+	_, _, err = g.GitlabClient.Projects.EditProject(g.path(name), eopts, gitlab.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ForkRepo forks a (remote) repository into the namespace owner, which is a user or a group path
+func (g *GitlabRemote) ForkRepo(ctx context.Context, name, owner string) (*Repository, error) {
+
+	fopts := new(gitlab.ForkProjectOptions)
+	if owner != "" {
+		fopts.Namespace = &owner
+	}
+
+	project, _, err := g.GitlabClient.Projects.ForkProject(g.path(name), fopts, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return gitlabRepository(project), nil
+}
+
+// ListRepos lists the repos of the configured group or the given owner, which is a user or a group namespace path.
+// Projects of descendant subgroups are only listed, if requested.
+func (g *GitlabRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	path := opts.owner()
+	if path == "" {
+		path = g.Provider.GroupName
+	}
+
+	ns, err := g.namespace(ctx, path)
+	if err != nil {
+		return errorIterator(err)
+	}
+
+	// Projects of a user namespace
+	if ns.Kind == "user" {
+		return NewRepoIterator(ctx, opts, gitlabPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+			truep := true
+			plopts := new(gitlab.ListProjectsOptions)
+
+			// Set search options (need to be pointers)
+			plopts.Page = page
+			plopts.PerPage = perPage
+			plopts.Statistics = &truep
+			plopts.OrderBy = gitlab.String("last_activity_at")
+
+			projects, resp, err := g.GitlabClient.Projects.ListUserProjects(ns.FullPath, plopts, gitlab.WithContext(ctx))
+			if err != nil {
+				return nil, 0, err
+			}
+
+			return gitlabRepositories(projects), resp.NextPage, nil
+		})
+	}
+
+	// Projects of a group and optionally its subgroups
+	subgroups := opts.includeSubgroups()
+	return NewRepoIterator(ctx, opts, gitlabPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		gpopts := new(gitlab.ListGroupProjectsOptions)
+		gpopts.Page = page
+		gpopts.PerPage = perPage
+		gpopts.IncludeSubgroups = &subgroups
+		gpopts.OrderBy = gitlab.String("last_activity_at")
+
+		projects, resp, err := g.GitlabClient.Groups.ListGroupProjects(ns.FullPath, gpopts, gitlab.WithContext(ctx), withStatistics)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return gitlabRepositories(projects), resp.NextPage, nil
+	})
+}
+
+// withStatistics requests the statistics of the projects, which the group listing options of the gitlab client lack
+func withStatistics(req *http.Request) error {
+
+	query := req.URL.Query()
+	query.Set("statistics", "true")
+	req.URL.RawQuery = query.Encode()
+
+	return nil
+}
+
+// path returns the path with namespace of the project name.
+// Names which already contain a namespace path, e.g. platform/backend/service, are returned unchanged.
+func (g *GitlabRemote) path(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return fmt.Sprintf("%s/%s", g.Provider.GroupName, name)
+}
+
+// gitlabRepositories converts a page of gitlab projects
+func gitlabRepositories(projects []*gitlab.Project) []*Repository {
+
+	repos := make([]*Repository, 0, len(projects))
+	for _, p := range projects {
+		repos = append(repos, gitlabRepository(p))
+	}
+
+	return repos
+}
+
+// gitlabRepository converts a gitlab project into a Repository
+func gitlabRepository(p *gitlab.Project) *Repository {
+
+	r := &Repository{
+		Name:          p.Name,
+		FullName:      p.PathWithNamespace,
+		Visibility:    Visibility(p.Visibility),
+		DefaultBranch: p.DefaultBranch,
+		SSHURL:        p.SSHURLToRepo,
+		HTTPURL:       p.HTTPURLToRepo,
+		WebURL:        p.WebURL,
+		Archived:      p.Archived,
+	}
+	if p.CreatedAt != nil {
+		r.Created = *p.CreatedAt
+	}
+	if p.LastActivityAt != nil {
+		r.Updated = *p.LastActivityAt
+	}
+	if p.Statistics != nil {
+		r.Size = p.Statistics.RepositorySize / 1024
+	}
+
+	return r
+}
+
+// NewGitlabRemote creates a new Remote object and returns it
+func NewGitlabRemote(p Provider) (*GitlabRemote, error) {
+
+	remote := new(GitlabRemote)
+
+	// If group name is empty, we set it to the owner or the user
+	if p.GroupName == "" {
+		p.GroupName = p.Owner
+	}
+	if p.GroupName == "" {
+		p.GroupName = p.User
+	}
+
+	remote.Provider = p
+	remote.GitlabClient = gitlab.NewClient(nil, p.Token)
+	if p.HostBaseURL != "" {
+		err := remote.GitlabClient.SetBaseURL(p.HostBaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid host base url %s: %s", p.HostBaseURL, err)
+		}
+	}
+
+	return remote, nil
+}
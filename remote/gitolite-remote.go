@@ -0,0 +1,388 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// gitoliteAdmin is the name of the admin repository of gitolite
+const gitoliteAdmin = "gitolite-admin"
+
+// gitoliteConf is the path of the main configuration file in the admin repository
+const gitoliteConf = "conf/gitolite.conf"
+
+func init() {
+	Register("gitolite", func(p Provider) (Remote, error) { return NewGitoliteRemote(p) }, Capabilities{
+		Visibilities: []Visibility{VisibilityPrivate},
+		Protocols:    []string{"ssh"},
+		ListOrder:    ListOrderName,
+	})
+}
+
+// GitoliteRemote implements Remote for gitolite.
+// Repositories are added to and removed from the configuration in the gitolite-admin repository,
+// gitolite applies the configuration when it is pushed.
+type GitoliteRemote struct {
+	Provider Provider
+
+	// SSH is the connection to the gitolite server, its HostKeyCallback may be replaced
+	SSH *SSHRemote
+}
+
+// url returns the ssh url of the repository name, gitolite ignores the leading slash
+func (g *GitoliteRemote) url(name string) string {
+	return g.SSH.url("/" + name)
+}
+
+// editConf clones the admin repository into memory, changes the configuration with edit, commits it with message and pushes it
+func (g *GitoliteRemote) editConf(ctx context.Context, message string, edit func(conf string) (string, error)) error {
+
+	auth, err := g.SSH.gitAuth()
+	if err != nil {
+		return err
+	}
+
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), memfs.New(), &git.CloneOptions{URL: g.url(gitoliteAdmin), Auth: auth})
+	if err != nil {
+		return fmt.Errorf("Could not clone %s: %s", gitoliteAdmin, err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	// Read and change the configuration
+	f, err := w.Filesystem.Open(gitoliteConf)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %s", gitoliteConf, err)
+	}
+	conf, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %s", gitoliteConf, err)
+	}
+
+	changed, err := edit(string(conf))
+	if err != nil {
+		return err
+	}
+
+	f, err = w.Filesystem.Create(gitoliteConf)
+	if err != nil {
+		return fmt.Errorf("Could not write %s: %s", gitoliteConf, err)
+	}
+	_, err = f.Write([]byte(changed))
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("Could not write %s: %s", gitoliteConf, err)
+	}
+
+	// Commit and push the configuration
+	_, err = w.Add(gitoliteConf)
+	if err != nil {
+		return err
+	}
+	author := g.Provider.User
+	if author == "" {
+		author = "gitrc"
+	}
+	_, err = w.Commit(message, &git.CommitOptions{Author: &object.Signature{Name: author, When: time.Now()}})
+	if err != nil {
+		return err
+	}
+
+	err = repo.PushContext(ctx, &git.PushOptions{Auth: auth})
+	if err != nil {
+		return fmt.Errorf("Could not push %s: %s", gitoliteAdmin, err)
+	}
+
+	return nil
+}
+
+// gitoliteHasRepo checks if a repo line of the configuration conf contains name
+func gitoliteHasRepo(conf, name string) bool {
+
+	for _, line := range strings.Split(conf, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "repo" {
+			continue
+		}
+		for _, n := range fields[1:] {
+			if n == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// gitoliteAddRepo appends a stanza for the repository name to the configuration conf, which grants user all permissions
+func gitoliteAddRepo(conf, name, user string) (string, error) {
+
+	if gitoliteHasRepo(conf, name) {
+		return "", fmt.Errorf("Repository %s already exists", name)
+	}
+
+	return fmt.Sprintf("%s\n\nrepo %s\n    RW+     =   %s\n", strings.TrimRight(conf, "\n"), name, user), nil
+}
+
+// gitoliteRemoveRepo removes name from the repo lines of the configuration conf.
+// Stanzas without repositories are removed with their rules, which end at the next repo line, group definition or include.
+// Blank lines and comments between the rules are removed with them, those after the last rule belong to the next stanza.
+func gitoliteRemoveRepo(conf, name string) (string, error) {
+
+	found := false
+	skip := false
+	lines := []string{}
+	pending := []string{}
+
+	for _, line := range strings.Split(conf, "\n") {
+		fields := strings.Fields(line)
+
+		if skip {
+			switch {
+			case len(fields) == 0 || strings.HasPrefix(fields[0], "#"):
+				pending = append(pending, line)
+				continue
+			case fields[0] != "repo" && !strings.HasPrefix(fields[0], "@") && fields[0] != "include" && fields[0] != "subconf":
+				pending = pending[:0]
+				continue
+			}
+			skip = false
+			lines = gitoliteKeep(lines, pending)
+			pending = pending[:0]
+		}
+
+		if len(fields) > 0 && fields[0] == "repo" {
+			names := []string{}
+			for _, n := range fields[1:] {
+				if n != name {
+					names = append(names, n)
+				}
+			}
+			if len(names) == 0 {
+				found, skip = true, true
+				continue
+			}
+			if len(names) < len(fields)-1 {
+				found = true
+				line = "repo " + strings.Join(names, " ")
+			}
+		}
+
+		lines = append(lines, line)
+	}
+	lines = gitoliteKeep(lines, pending)
+
+	if !found {
+		return "", fmt.Errorf("Repository %s not found in %s", name, gitoliteConf)
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n", nil
+}
+
+// gitoliteKeep appends the blank lines and comments after a removed stanza to lines,
+// a blank line, which separated the removed stanza, is neither doubled nor left at the start
+func gitoliteKeep(lines, pending []string) []string {
+
+	if len(pending) > 0 && strings.TrimSpace(pending[0]) == "" && (len(lines) == 0 || strings.TrimSpace(lines[len(lines)-1]) == "") {
+		pending = pending[1:]
+	}
+
+	return append(lines, pending...)
+}
+
+// CreateRepo adds the repository to the configuration, which grants the user all permissions, and pushes a basic README.
+// Only the users of rules in the configuration can access repositories, so they are always private.
+func (g *GitoliteRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	visibility, err := opts.visibility(g.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if visibility != VisibilityPrivate {
+		return nil, unsupportedVisibility(g.Provider.Type, visibility)
+	}
+
+	name = strings.TrimSuffix(name, ".git")
+	err = checkName(name)
+	if err != nil {
+		return nil, err
+	}
+	if g.Provider.User == "" {
+		return nil, fmt.Errorf("No user configured for gitolite, the user is granted access to new repositories")
+	}
+
+	// Create repo
+	err = g.editConf(ctx, fmt.Sprintf("Added repository %s", name), func(conf string) (string, error) {
+		return gitoliteAddRepo(conf, name, g.Provider.User)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a basic README, a repository without it is removed from the configuration again
+	auth, err := g.SSH.gitAuth()
+	if err == nil {
+		_, repoName := splitName(name)
+		err = pushReadme(ctx, g.url(name), auth, g.Provider.User, repoName)
+	}
+	if err != nil {
+		g.editConf(ctx, fmt.Sprintf("Removed repository %s", name), func(conf string) (string, error) {
+			return gitoliteRemoveRepo(conf, name)
+		})
+		return nil, fmt.Errorf("Could not push the README to %s: %s", name, err)
+	}
+
+	repo := g.repository(name)
+	repo.DefaultBranch = "master"
+	repo.Created = time.Now()
+	repo.Updated = repo.Created
+
+	return repo, nil
+}
+
+// CloneRepo clones the remote repository
+func (g *GitoliteRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	endpoint, err := transport.NewEndpoint(g.url(strings.TrimSuffix(name, ".git")))
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := g.SSH.gitAuth()
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo removes the repository from the configuration, which revokes all access.
+// gitolite keeps the repository on the server, until an administrator deletes it.
+func (g *GitoliteRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	name = strings.TrimSuffix(name, ".git")
+	if name == gitoliteAdmin {
+		return fmt.Errorf("The admin repository %s can't be deleted", gitoliteAdmin)
+	}
+
+	err := g.editConf(ctx, fmt.Sprintf("Removed repository %s", name), func(conf string) (string, error) {
+		return gitoliteRemoveRepo(conf, name)
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos lists the repositories the user can access according to the info command, optionally only those of the owner.
+// Wildcard patterns of repositories, which the user may create, are skipped.
+func (g *GitoliteRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	owner := opts.owner()
+	if owner == "" {
+		owner = g.Provider.Owner
+	}
+
+	// info lists all repositories at once
+	return NewRepoIterator(ctx, opts, 0, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		out, err := g.SSH.run(ctx, "info")
+		if err != nil {
+			return nil, 0, err
+		}
+
+		repos := []*Repository{}
+		for _, name := range parseGitoliteInfo(out) {
+			if owner == "" || strings.HasPrefix(name, strings.TrimSuffix(owner, "/")+"/") {
+				repos = append(repos, g.repository(name))
+			}
+		}
+
+		return repos, 0, nil
+	})
+}
+
+// parseGitoliteInfo returns the repositories of the output of the info command sorted by name.
+// Repositories are listed after a tab and their permissions, wildcard patterns have the permission C.
+func parseGitoliteInfo(out string) []string {
+
+	names := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		i := strings.LastIndex(line, "\t")
+		if i < 0 || strings.Contains(line[:i], "C") {
+			continue
+		}
+		if name := strings.TrimSpace(line[i+1:]); name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// repository returns the Repository of the repository name
+func (g *GitoliteRemote) repository(name string) *Repository {
+
+	_, base := splitName(name)
+
+	return &Repository{
+		Name:       base,
+		FullName:   name,
+		Visibility: VisibilityPrivate,
+		SSHURL:     g.url(name),
+	}
+}
+
+// NewGitoliteRemote creates a new Remote object and returns it.
+// The host base url is the ssh url of the gitolite server like ssh://git@example.com, the ssh user defaults to git.
+// The user is the gitolite user, who is granted access to new repositories.
+func NewGitoliteRemote(p Provider) (*GitoliteRemote, error) {
+
+	var err error
+
+	remote := new(GitoliteRemote)
+
+	if p.Type == "" {
+		p.Type = "gitolite"
+	}
+
+	remote.SSH, err = newSSHRemote(p, "git")
+	if err != nil {
+		return nil, err
+	}
+
+	remote.Provider = p
+
+	return remote, nil
+}
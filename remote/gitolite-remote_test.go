@@ -0,0 +1,256 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// gitoliteTestConf is the configuration of the admin repository of the stand-in
+const gitoliteTestConf = `@staff = alice bob
+
+repo gitolite-admin
+    RW+     =   alice
+
+# Everybody may test
+repo testing
+    RW+     =   @all
+
+repo wild/..*
+    C       =   @staff
+    RW+     =   CREATOR
+`
+
+// gitoliteCreate creates the bare repositories of the configuration like gitolite does, when the admin repository is pushed.
+// The stand-in runs it before each git command instead, a hook would race with the next connection of the client.
+const gitoliteCreate = `git --git-dir=gitolite-admin.git show master:conf/gitolite.conf | awk '$1 == "repo" { for (i = 2; i <= NF; i++) if ($i !~ /\.\./) print $i }' | while read -r r; do
+	test -d "$r.git" || { git init --bare -q "$r.git" && git --git-dir="$r.git" symbolic-ref HEAD refs/heads/master; }
+done; `
+
+// gitoliteInfo prints the repositories of the configuration like the info command of gitolite, wildcard patterns get the permission C
+const gitoliteInfo = `echo 'hello alice, this is git@stand-in running gitolite3 v3.6.12 on git 2.20.1'; echo
+git --git-dir=gitolite-admin.git show master:conf/gitolite.conf | awk '$1 == "repo" { for (i = 2; i <= NF; i++) printf($i ~ /\.\./ ? " R W C\t%s\n" : " R W\t%s\n", $i) }'`
+
+// gitoliteGit runs git in dir
+func gitoliteGit(t *testing.T, dir string, args ...string) {
+
+	t.Helper()
+
+	c := exec.Command("git", append([]string{"-c", "user.name=alice", "-c", "user.email=alice@example.com"}, args...)...)
+	c.Dir = dir
+	if out, err := c.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+	}
+}
+
+// newGitoliteStandIn turns the ssh stand-in into a gitolite server with the admin repository of gitoliteTestConf.
+// Repository paths are relative to the base path, info lists the repositories of the configuration.
+func newGitoliteStandIn(t *testing.T) (*sshStandIn, *GitoliteRemote) {
+
+	s := newSSHStandIn(t)
+	s.rewrite = func(cmd string) string {
+		if cmd == "info" {
+			return gitoliteInfo
+		}
+		return gitoliteCreate + strings.Replace(cmd, " '/", " '", 1)
+	}
+
+	admin := filepath.Join(s.base, gitoliteAdmin+".git")
+	work := filepath.Join(s.base, "..", "admin")
+	gitoliteGit(t, s.base, "init", "--bare", "-q", admin)
+	gitoliteGit(t, admin, "symbolic-ref", "HEAD", "refs/heads/master")
+	gitoliteGit(t, s.base, "init", "-q", work)
+	if err := os.Mkdir(filepath.Join(work, "conf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(work, gitoliteConf), []byte(gitoliteTestConf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitoliteGit(t, work, "add", gitoliteConf)
+	gitoliteGit(t, work, "commit", "-q", "-m", "Initial configuration")
+	gitoliteGit(t, work, "push", "-q", admin, "HEAD:refs/heads/master")
+
+	r, err := NewGitoliteRemote(Provider{HostBaseURL: "ssh://alice@" + s.listener.Addr().String(), User: "alice", SSHKeyFile: s.keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SSH.HostKeyCallback = ssh.FixedHostKey(s.hostKey)
+
+	return s, r
+}
+
+// adminConf returns the configuration of the admin repository of the stand-in
+func adminConf(t *testing.T, s *sshStandIn) string {
+
+	out, err := exec.Command("git", "--git-dir", filepath.Join(s.base, gitoliteAdmin+".git"), "show", "master:"+gitoliteConf).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+
+	return string(out)
+}
+
+func TestGitoliteAddRepo(t *testing.T) {
+
+	tests := []struct {
+		name string
+		conf string
+		want string
+		err  bool
+	}{
+		{"tool", "repo testing\n    RW+ = @all\n\n\n", "repo testing\n    RW+ = @all\n\nrepo tool\n    RW+     =   alice\n", false},
+		{"tool", "# repo tool\n", "# repo tool\n\nrepo tool\n    RW+     =   alice\n", false},
+		{"tool", "@tools = tool lib\n", "@tools = tool lib\n\nrepo tool\n    RW+     =   alice\n", false},
+		{"tool", "repo lib tool\n    RW = bob\n", "", true},
+		{"tool", "repo  tool\n", "", true},
+	}
+
+	for i, test := range tests {
+		conf, err := gitoliteAddRepo(test.conf, test.name, "alice")
+		if (err != nil) != test.err || conf != test.want {
+			t.Errorf("%d: Added %s as %q, %v, want %q", i, test.name, conf, err, test.want)
+		}
+	}
+}
+
+func TestGitoliteRemoveRepo(t *testing.T) {
+
+	tests := []struct {
+		conf string
+		want string
+		err  bool
+	}{
+		// Neighbouring stanzas and the comment of the next one are kept
+		{"repo lib\n    RW = bob\n\nrepo tool\n    RW+ = alice\n\n# The tests\nrepo testing\n    RW+ = @all\n",
+			"repo lib\n    RW = bob\n\n# The tests\nrepo testing\n    RW+ = @all\n", false},
+		// Comments and blank lines between the rules are removed with them
+		{"repo tool\n    # alice owns it\n    RW+ = alice\n\n    R = bob\nrepo lib\n    RW = bob\n",
+			"repo lib\n    RW = bob\n", false},
+		// Rules end at group definitions and includes
+		{"repo tool\n    RW+ = alice\n@staff = alice bob\ninclude \"other.conf\"\n",
+			"@staff = alice bob\ninclude \"other.conf\"\n", false},
+		{"repo lib\n    RW = bob\n\nrepo tool\n    RW+ = alice\n\n",
+			"repo lib\n    RW = bob\n", false},
+		// Stanzas of several repositories keep their rules
+		{"repo lib tool wild/..*\n    RW+ = alice\n", "repo lib wild/..*\n    RW+ = alice\n", false},
+		{"repo tool\n    RW+ = alice\n", "\n", false},
+		{"# repo tool\n@tools = tool\nrepo lib\n", "", true},
+	}
+
+	for i, test := range tests {
+		conf, err := gitoliteRemoveRepo(test.conf, "tool")
+		if (err != nil) != test.err || conf != test.want {
+			t.Errorf("%d: Removed tool as %q, %v, want %q", i, conf, err, test.want)
+		}
+	}
+}
+
+func TestParseGitoliteInfo(t *testing.T) {
+
+	tests := []struct {
+		out  string
+		want []string
+	}{
+		{"hello alice, this is git@example.com running gitolite3 v3.6.12 on git 2.20.1\n\n R W C\twild/..*\n R W\tteam/tool\n R  \ttesting\n R W\tgitolite-admin\n",
+			[]string{"gitolite-admin", "team/tool", "testing"}},
+		{" R W C\tCREATOR/..*\n R W C\t@staff/..*\n", []string{}},
+		{"hello alice, this is git@example.com running gitolite3\n", []string{}},
+	}
+
+	for i, test := range tests {
+		if names := parseGitoliteInfo(test.out); fmt.Sprint(names) != fmt.Sprint(test.want) {
+			t.Errorf("%d: Parsed %v, want %v", i, names, test.want)
+		}
+	}
+}
+
+func TestGitoliteRoundTrip(t *testing.T) {
+
+	s, r := newGitoliteStandIn(t)
+	ctx := context.Background()
+
+	repo, err := r.CreateRepo(ctx, "team/tool", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "team/tool" || repo.SSHURL != "ssh://alice@"+r.SSH.Host+"/team/tool" {
+		t.Errorf("Created %s with the ssh url %s", repo.FullName, repo.SSHURL)
+	}
+	if conf := adminConf(t, s); !strings.Contains(conf, "\nrepo team/tool\n    RW+     =   alice\n") {
+		t.Errorf("Configuration has no stanza of team/tool:\n%s", conf)
+	}
+	if files := s.bareHead(t, "team/tool"); len(files) != 1 || files[0] != "README.md" {
+		t.Errorf("Repository contains %v, want the README.md", files)
+	}
+
+	repos, err := r.ListRepos(ctx, nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, repo := range repos {
+		names = append(names, repo.FullName)
+	}
+	if fmt.Sprint(names) != "[gitolite-admin team/tool testing]" {
+		t.Errorf("Listed %v, want gitolite-admin, team/tool and testing", names)
+	}
+
+	if _, err = r.CreateRepo(ctx, "testing", nil); err == nil || !strings.Contains(err.Error(), "Repository testing already exists") {
+		t.Errorf("Creating an existing repository returned %v", err)
+	}
+
+	if err = r.DeleteRepo(ctx, "team/tool"); err != nil {
+		t.Fatal(err)
+	}
+	if conf := adminConf(t, s); conf != gitoliteTestConf {
+		t.Errorf("Configuration after the deletion is\n%s\nwant\n%s", conf, gitoliteTestConf)
+	}
+	repos, err = r.ListRepos(ctx, &ListOptions{Owner: "team"}).All()
+	if err != nil || len(repos) != 0 {
+		t.Errorf("Listed %v, %v for team after the deletion, want no repositories", repos, err)
+	}
+	if err = r.DeleteRepo(ctx, gitoliteAdmin); err == nil {
+		t.Errorf("Deleting the admin repository succeeded")
+	}
+
+	// New repositories get a hook rejecting the push of the README, the repository is removed from the configuration again
+	templates := filepath.Join(s.base, "..", "templates")
+	if err = os.MkdirAll(filepath.Join(templates, "hooks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(templates, "hooks", "pre-receive"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GIT_TEMPLATE_DIR", templates)
+	defer os.Unsetenv("GIT_TEMPLATE_DIR")
+	_, err = r.CreateRepo(ctx, "rejected", nil)
+	if err == nil || !strings.Contains(err.Error(), "Could not push the README to rejected") {
+		t.Errorf("Creating a repository with a rejected push returned %v", err)
+	}
+	if conf := adminConf(t, s); conf != gitoliteTestConf {
+		t.Errorf("Configuration after the rejected push is\n%s\nwant\n%s", conf, gitoliteTestConf)
+	}
+}
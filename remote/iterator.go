@@ -0,0 +1,202 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// Done is returned by RepoIterator.Next, when there are no more repositories
+var Done = errors.New("no more repositories")
+
+// ListOptions contains the options for listing repositories
+type ListOptions struct {
+	// Limit is the maximum number of repositories to list, 0 lists all repositories
+	Limit int
+	// Owner is the user or organisation to list the repositories of, it defaults to the configured owner
+	Owner string
+	// Type filters the repositories, e.g. "forks" or "member", the supported types depend on the provider
+	Type string
+	// IncludeSubgroups also lists the repositories of all descendant groups, if the provider supports nested groups
+	IncludeSubgroups bool
+}
+
+// limit returns the maximum number of repositories to list
+func (o *ListOptions) limit() int {
+	if o == nil {
+		return 0
+	}
+	return o.Limit
+}
+
+// owner returns the owner to list the repositories of
+func (o *ListOptions) owner() string {
+	if o == nil {
+		return ""
+	}
+	return o.Owner
+}
+
+// typ returns the type filter of the listing
+func (o *ListOptions) typ() string {
+	if o == nil {
+		return ""
+	}
+	return o.Type
+}
+
+// includeSubgroups checks if the repositories of descendant groups are listed
+func (o *ListOptions) includeSubgroups() bool {
+	return o != nil && o.IncludeSubgroups
+}
+
+// PageFunc fetches a single page of repositories.
+// Pages are numbered from 1, perPage is the requested page size.
+// It returns the repositories of the page and the number of the next page, which is 0 after the last page.
+type PageFunc func(ctx context.Context, page, perPage int) ([]*Repository, int, error)
+
+// RepoIterator iterates over a listing of repositories.
+// Pages are fetched from the provider when they are needed,
+// so the first repositories are available before the whole listing was fetched.
+type RepoIterator struct {
+	ctx     context.Context
+	fetch   PageFunc
+	perPage int
+	limit   int
+
+	buf   []*Repository
+	page  int
+	count int
+	err   error
+}
+
+// NewRepoIterator creates an iterator, which fetches pages of perPage repositories with fetch
+func NewRepoIterator(ctx context.Context, opts *ListOptions, perPage int, fetch PageFunc) *RepoIterator {
+
+	it := &RepoIterator{
+		ctx:     ctx,
+		fetch:   fetch,
+		perPage: perPage,
+		limit:   opts.limit(),
+		page:    1,
+	}
+
+	// Don't fetch more than we need
+	if it.limit > 0 && it.limit < it.perPage {
+		it.perPage = it.limit
+	}
+
+	return it
+}
+
+// errorIterator returns an iterator, which only returns err
+func errorIterator(err error) *RepoIterator {
+	return &RepoIterator{err: err}
+}
+
+// Next returns the next repository of the listing.
+// It returns Done, if there are no more repositories.
+func (it *RepoIterator) Next() (*Repository, error) {
+
+	if it.err != nil {
+		return nil, it.err
+	}
+	if it.limit > 0 && it.count >= it.limit {
+		it.err = Done
+		return nil, it.err
+	}
+
+	// Fetch pages until we have repositories or there are no more pages
+	for len(it.buf) == 0 {
+		if it.page == 0 {
+			it.err = Done
+			return nil, it.err
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			return nil, err
+		}
+		it.buf, it.page, it.err = it.fetch(it.ctx, it.page, it.perPage)
+		if it.err != nil {
+			return nil, it.err
+		}
+	}
+
+	r := it.buf[0]
+	it.buf = it.buf[1:]
+	it.count++
+
+	return r, nil
+}
+
+// All returns all remaining repositories of the listing
+func (it *RepoIterator) All() ([]*Repository, error) {
+
+	repos := []*Repository{}
+	for {
+		r, err := it.Next()
+		if err == Done {
+			return repos, nil
+		}
+		if err != nil {
+			return repos, err
+		}
+		repos = append(repos, r)
+	}
+}
+
+// sortByName returns a PageFunc, which fetches all pages of perPage repositories with fetch at once
+// and pages the repositories sorted by their full name. It is used for apis, which list in no defined order.
+func sortByName(perPage int, fetch PageFunc) PageFunc {
+
+	var all []*Repository
+
+	return func(ctx context.Context, page, size int) ([]*Repository, int, error) {
+
+		if page == 1 {
+			all = nil
+			for p := 1; p != 0; {
+				repos, next, err := fetch(ctx, p, perPage)
+				if err != nil {
+					return nil, 0, err
+				}
+				all = append(all, repos...)
+				p = next
+			}
+			sort.SliceStable(all, func(i, j int) bool { return all[i].FullName < all[j].FullName })
+		}
+
+		// A size of 0 pages everything at once
+		start := (page - 1) * size
+		end := start + size
+		if size == 0 || end >= len(all) {
+			end = len(all)
+		}
+		if start >= end {
+			return nil, 0, nil
+		}
+
+		next := page + 1
+		if end == len(all) {
+			next = 0
+		}
+
+		return all[start:end], next, nil
+	}
+}
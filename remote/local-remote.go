@@ -0,0 +1,410 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// localPerPage is the number of repositories, whose details are read at once
+const localPerPage = 100
+
+func init() {
+	Register("local", func(p Provider) (Remote, error) { return NewLocalRemote(p) }, Capabilities{
+		Visibilities: []Visibility{VisibilityPrivate},
+		Protocols:    []string{"file"},
+		ListOrder:    ListOrderName,
+	})
+}
+
+// LocalRemote implements Remote for bare repositories in a directory of the local filesystem.
+// Repositories are named by their path below the directory without the .git suffix, e.g. "team/name".
+type LocalRemote struct {
+	Provider Provider
+
+	// Dir is the absolute path of the directory containing the repositories
+	Dir string
+}
+
+// join returns the path of name below the directory of the remote, names must not leave the directory
+func (l *LocalRemote) join(name string) (string, error) {
+
+	err := checkName(name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(l.Dir, filepath.FromSlash(name)), nil
+}
+
+// dir returns the directory of a new repository name, which gets the .git suffix
+func (l *LocalRemote) dir(name string) (string, error) {
+
+	dir, err := l.join(strings.TrimSuffix(name, ".git"))
+	if err != nil {
+		return "", err
+	}
+
+	return dir + ".git", nil
+}
+
+// find returns the directory of the existing repository name, repositories without the .git suffix are found as well
+func (l *LocalRemote) find(name string) (string, error) {
+
+	dir, err := l.dir(name)
+	if err != nil {
+		return "", err
+	}
+	if isBare(dir) {
+		return dir, nil
+	}
+
+	dir, err = l.join(name)
+	if err != nil {
+		return "", err
+	}
+	if isBare(dir) {
+		return dir, nil
+	}
+
+	return "", fmt.Errorf("Repository %s not found in %s", name, l.Dir)
+}
+
+// isBare checks if dir is a bare repository
+func isBare(dir string) bool {
+
+	for _, f := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CreateRepo creates a bare repository with an initial commit of a basic README.
+// Local repositories are only accessible to users of the filesystem, so they are always private.
+func (l *LocalRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	visibility, err := opts.visibility(l.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if visibility != VisibilityPrivate {
+		return nil, unsupportedVisibility(l.Provider.Type, visibility)
+	}
+
+	dir, err := l.dir(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("Repository %s already exists in %s", name, l.Dir)
+	}
+
+	// Create repo
+	repo, err := git.PlainInit(dir, true)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create repository %s: %s", dir, err)
+	}
+
+	// Create a basic README
+	_, repoName := splitName(strings.TrimSuffix(name, ".git"))
+	err = commitReadme(repo, l.Provider.User, repoName)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("Could not commit the README to %s: %s", dir, err)
+	}
+
+	r, err := l.repository(dir)
+	if err != nil {
+		return nil, err
+	}
+	r.Created = r.Updated
+
+	return r, nil
+}
+
+// CloneRepo clones the repository over file://
+func (l *LocalRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	dir, err := l.find(name)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := transport.NewEndpoint(localURL(dir))
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	return cloneEndpoint(ctx, endpoint, nil, name, opts)
+}
+
+// CloneURL returns the file url of the repository, which is the same for all protocols
+func (l *LocalRemote) CloneURL(ctx context.Context, name, protocol string) (string, error) {
+
+	dir, err := l.find(name)
+	if err != nil {
+		return "", err
+	}
+
+	return localURL(dir), nil
+}
+
+// DeleteRepo deletes a repository
+func (l *LocalRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	dir, err := l.find(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return fmt.Errorf("Could not delete %s: %s", dir, err)
+	}
+
+	return nil
+}
+
+// RenameRepo renames a repository within its directory
+func (l *LocalRemote) RenameRepo(ctx context.Context, name, newName string) error {
+
+	err := checkNewName(newName)
+	if err != nil {
+		return err
+	}
+
+	dir, err := l.find(name)
+	if err != nil {
+		return err
+	}
+
+	owner, _ := splitName(strings.TrimSuffix(name, ".git"))
+	if owner != "" {
+		newName = owner + "/" + newName
+	}
+	newDir, err := l.dir(newName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(newDir); err == nil {
+		return fmt.Errorf("Repository %s already exists in %s", newName, l.Dir)
+	}
+
+	err = os.Rename(dir, newDir)
+	if err != nil {
+		return fmt.Errorf("Could not rename %s: %s", dir, err)
+	}
+
+	return nil
+}
+
+// ListRepos lists the bare repositories below the directory of the owner or of the remote.
+// The directory is scanned once, the details of the repositories are read page by page.
+func (l *LocalRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	owner := opts.owner()
+	if owner == "" {
+		owner = l.Provider.Owner
+	}
+
+	var all []string
+
+	return NewRepoIterator(ctx, opts, localPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		if page == 1 {
+			var err error
+			root := l.Dir
+			if owner != "" {
+				root, err = l.join(owner)
+				if err != nil {
+					return nil, 0, err
+				}
+			}
+
+			all, err = scanBare(ctx, root)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		start := (page - 1) * perPage
+		end := start + perPage
+		if end >= len(all) {
+			end = len(all)
+		}
+		if start >= end {
+			return nil, 0, nil
+		}
+
+		repos := make([]*Repository, 0, end-start)
+		for _, dir := range all[start:end] {
+			r, err := l.repository(dir)
+			if err != nil {
+				return nil, 0, err
+			}
+			repos = append(repos, r)
+		}
+
+		next := page + 1
+		if end == len(all) {
+			next = 0
+		}
+
+		return repos, next, nil
+	})
+}
+
+// scanBare returns the bare repositories below root sorted by their name, there are none if root does not exist.
+// The .git directories of worktrees and the contents of bare repositories are skipped.
+func scanBare(ctx context.Context, root string) ([]string, error) {
+
+	dirs := []string{}
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return dirs, nil
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.IsDir() || path == root {
+			return nil
+		}
+		if info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if isBare(path) {
+			dirs = append(dirs, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not scan %s for repositories: %s", root, err)
+	}
+
+	// Walk sorts by path, but the listing is sorted by the names without .git
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.TrimSuffix(filepath.ToSlash(dirs[i]), ".git") < strings.TrimSuffix(filepath.ToSlash(dirs[j]), ".git")
+	})
+
+	return dirs, nil
+}
+
+// repository reads the details of the bare repository in dir.
+// The last update is the date of the last commit, it is zero for empty repositories.
+func (l *LocalRemote) repository(dir string) (*Repository, error) {
+
+	rel, err := filepath.Rel(l.Dir, dir)
+	if err != nil {
+		return nil, err
+	}
+	fullName := strings.TrimSuffix(filepath.ToSlash(rel), ".git")
+	_, name := splitName(fullName)
+
+	location := localURL(dir)
+	repo := &Repository{
+		Name:       name,
+		FullName:   fullName,
+		Visibility: VisibilityPrivate,
+		SSHURL:     location,
+		HTTPURL:    location,
+	}
+
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open repository %s: %s", dir, err)
+	}
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err == nil && head.Type() == plumbing.SymbolicReference {
+		repo.DefaultBranch = head.Target().Short()
+	}
+
+	ref, err := r.Head()
+	if err == nil {
+		commit, err := r.CommitObject(ref.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("Could not read the last commit of %s: %s", dir, err)
+		}
+		repo.Updated = commit.Committer.When
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, fmt.Errorf("Could not read HEAD of %s: %s", dir, err)
+	}
+
+	// Sum up the size of all files
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			repo.Size += info.Size()
+		}
+		return nil
+	})
+	repo.Size /= 1024
+
+	return repo, nil
+}
+
+// localURL returns the file url of the directory dir
+func localURL(dir string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String()
+}
+
+// NewLocalRemote creates a new Remote object and returns it.
+// The host base url is the directory of the repositories, it may start with file:// or ~.
+func NewLocalRemote(p Provider) (*LocalRemote, error) {
+
+	if p.HostBaseURL == "" {
+		return nil, fmt.Errorf("No host_base_url configured for local, the directory of the repositories is unknown")
+	}
+
+	remote := new(LocalRemote)
+
+	if p.Type == "" {
+		p.Type = "local"
+	}
+
+	dir := strings.TrimPrefix(p.HostBaseURL, "file://")
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		dir = filepath.Join(os.Getenv("HOME"), dir[1:])
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid directory %s: %s", p.HostBaseURL, err)
+	}
+
+	remote.Provider = p
+	remote.Dir = dir
+
+	return remote, nil
+}
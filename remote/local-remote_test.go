@@ -0,0 +1,61 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+func TestLocalListOrder(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gitrc-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The paths sort as a/x.git, a-b.git, foo-bar.git, foo.git
+	for _, name := range []string{"foo", "foo-bar", "a/x", "a-b"} {
+		if _, err := git.PlainInit(filepath.Join(dir, name+".git"), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewLocalRemote(Provider{HostBaseURL: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos, err := r.ListRepos(context.Background(), nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, repo := range repos {
+		names = append(names, repo.FullName)
+	}
+	if strings.Join(names, ",") != "a-b,a/x,foo,foo-bar" {
+		t.Errorf("Listed %v, want a-b, a/x, foo, foo-bar", names)
+	}
+}
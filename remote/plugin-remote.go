@@ -0,0 +1,453 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// pluginPerPage is the page size requested from plugins
+const pluginPerPage = 100
+
+// PluginRemote implements Remote with an external provider plugin.
+// The plugin is started on the first request and runs until Close is called or gitrc exits.
+type PluginRemote struct {
+	Provider Provider
+
+	// Path is the path of the plugin executable
+	Path string
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	dec     *json.Decoder
+	methods []string
+	lists   int
+}
+
+// FindPlugin returns the path of the plugin for the provider type typ, which is named gitrc-provider-<typ> and searched on PATH.
+// If typ is a path, it is used as path of the plugin.
+func FindPlugin(typ string) (string, error) {
+
+	if strings.ContainsRune(typ, filepath.Separator) || strings.Contains(typ, "/") {
+		if _, err := os.Stat(typ); err != nil {
+			return "", fmt.Errorf("Could not find plugin %s: %s", typ, err)
+		}
+		return typ, nil
+	}
+
+	path, err := exec.LookPath(PluginPrefix + typ)
+	if err != nil {
+		return "", fmt.Errorf("No plugin %s%s found on PATH", PluginPrefix, typ)
+	}
+
+	return path, nil
+}
+
+// start starts the plugin and shakes hands with it
+func (r *PluginRemote) start(ctx context.Context) error {
+
+	cmd := exec.Command(r.Path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("Could not start plugin %s: %s", r.Path, err)
+	}
+	r.cmd, r.stdin, r.dec = cmd, stdin, json.NewDecoder(stdout)
+
+	provider := r.Provider
+	resp, err := r.roundTrip(ctx, &PluginRequest{Method: PluginHandshake, Provider: &provider})
+	if err != nil {
+		r.stop()
+		return err
+	}
+	r.methods = resp.Methods
+
+	return nil
+}
+
+// stop closes stdin of the plugin and waits for it to exit
+func (r *PluginRemote) stop() error {
+
+	if r.cmd == nil {
+		return nil
+	}
+
+	r.stdin.Close()
+	err := r.cmd.Wait()
+	r.cmd = nil
+
+	return err
+}
+
+// kill kills the plugin, after which it can't be used any longer
+func (r *PluginRemote) kill() {
+
+	if r.cmd == nil {
+		return
+	}
+
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	r.cmd = nil
+}
+
+// Close stops the plugin
+func (r *PluginRemote) Close() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.stop()
+}
+
+// supports checks if the plugin supports method
+func (r *PluginRemote) supports(method string) bool {
+
+	for _, m := range r.methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// roundTrip sends req to the running plugin and reads its response.
+// The plugin is killed, when ctx is done or when it breaks the protocol.
+func (r *PluginRemote) roundTrip(ctx context.Context, req *PluginRequest) (*PluginResponse, error) {
+
+	req.Version = PluginProtocolVersion
+	resp := new(PluginResponse)
+
+	done := make(chan error, 1)
+	go func() {
+		err := json.NewEncoder(r.stdin).Encode(req)
+		if err == nil {
+			err = r.dec.Decode(resp)
+		}
+		done <- err
+	}()
+
+	select {
+	case <-ctx.Done():
+		r.kill()
+		return nil, ctx.Err()
+	case err := <-done:
+		if err != nil {
+			r.kill()
+			return nil, fmt.Errorf("Plugin %s failed: %s", r.Path, err)
+		}
+	}
+
+	if resp.Version != PluginProtocolVersion {
+		r.kill()
+		return nil, fmt.Errorf("Plugin %s speaks protocol version %d, gitrc speaks version %d", r.Path, resp.Version, PluginProtocolVersion)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp, nil
+}
+
+// call sends a request to the plugin, which is started if it is not running
+func (r *PluginRemote) call(ctx context.Context, req *PluginRequest) (*PluginResponse, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cmd == nil {
+		err := r.start(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !r.supports(req.Method) {
+		return nil, fmt.Errorf("Plugin %s does not support %s", r.Path, req.Method)
+	}
+
+	return r.roundTrip(ctx, req)
+}
+
+// CreateRepo creates a remote repository
+func (r *PluginRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	visibility, err := opts.visibility(r.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.call(ctx, &PluginRequest{Method: PluginCreate, Name: name, Visibility: visibility})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Repository == nil {
+		return nil, fmt.Errorf("Plugin %s returned no repository", r.Path)
+	}
+
+	return resp.Repository, nil
+}
+
+// CloneRepo clones the remote repository from the clone url resolved by the plugin
+func (r *PluginRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	protocol := r.Provider.CloneProtocol
+	if protocol == "" {
+		protocol = "ssh"
+	}
+
+	resp, err := r.call(ctx, &PluginRequest{Method: PluginCloneURL, Name: name, Protocol: protocol})
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := transport.NewEndpoint(resp.URL)
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+	if endpoint.Protocol == "http" || endpoint.Protocol == "https" {
+		endpoint.User, endpoint.Password = resp.User, resp.Password
+		if endpoint.User == "" && endpoint.Password == "" {
+			endpoint.User, endpoint.Password = r.Provider.User, r.Provider.Password
+			if r.Provider.Token != "" {
+				endpoint.Password = r.Provider.Token
+			}
+		}
+	}
+
+	auth, err := sshAuth(r.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository
+func (r *PluginRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	_, err := r.call(ctx, &PluginRequest{Method: PluginDelete, Name: name})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos lists the repositories page by page
+func (r *PluginRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	r.mu.Lock()
+	r.lists++
+	id := r.lists
+	r.mu.Unlock()
+
+	return NewRepoIterator(ctx, opts, pluginPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		resp, err := r.call(ctx, &PluginRequest{Method: PluginList, List: &PluginListParams{
+			ID:               id,
+			Owner:            opts.owner(),
+			Type:             opts.typ(),
+			IncludeSubgroups: opts.includeSubgroups(),
+			Page:             page,
+			PerPage:          perPage,
+		}})
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.NextPage != 0 && resp.NextPage <= page {
+			return nil, 0, fmt.Errorf("Plugin %s returned the next page %d for page %d", r.Path, resp.NextPage, page)
+		}
+
+		return resp.Repositories, resp.NextPage, nil
+	})
+}
+
+// PluginCheck is the result of a single check of a plugin
+type PluginCheck struct {
+	Check   string `json:"check" yaml:"check"`
+	Result  string `json:"result" yaml:"result"` // ok, failed or skipped
+	Message string `json:"message" yaml:"message"`
+}
+
+// Results of plugin checks
+const (
+	PluginCheckOK      = "ok"
+	PluginCheckFailed  = "failed"
+	PluginCheckSkipped = "skipped"
+)
+
+// CheckPlugin checks that the plugin at path follows the plugin protocol, the settings p are passed to the plugin.
+// Only the handshake and requests, which don't change anything, are sent unless write is set.
+// With write a temporary repository is created, its clone url is resolved and it is deleted again.
+func CheckPlugin(ctx context.Context, path string, p Provider, write bool) []*PluginCheck {
+
+	r, _ := NewPluginRemote(path, p)
+	defer r.Close()
+
+	var checks []*PluginCheck
+	add := func(check string, err error, ok string) {
+		c := &PluginCheck{Check: check, Result: PluginCheckOK, Message: ok}
+		if err != nil {
+			c.Result, c.Message = PluginCheckFailed, err.Error()
+		}
+		checks = append(checks, c)
+	}
+	skip := func(check, reason string) {
+		checks = append(checks, &PluginCheck{Check: check, Result: PluginCheckSkipped, Message: reason})
+	}
+
+	// Without a handshake nothing else can be checked
+	r.mu.Lock()
+	err := r.start(ctx)
+	r.mu.Unlock()
+	add(PluginHandshake, err, fmt.Sprintf("Protocol version %d, methods: %s", PluginProtocolVersion, strings.Join(r.methods, ", ")))
+	if err != nil {
+		return checks
+	}
+	for _, m := range r.methods {
+		found := false
+		for _, known := range PluginMethods {
+			found = found || m == known
+		}
+		if !found {
+			add("methods", fmt.Errorf("Unknown method %s in the handshake", m), "")
+		}
+	}
+
+	// Unknown methods are answered with an error, the plugin keeps running
+	r.mu.Lock()
+	_, err = r.roundTrip(ctx, &PluginRequest{Method: "gitrc-check-unknown"})
+	broken := r.cmd == nil
+	r.mu.Unlock()
+	switch {
+	case broken:
+		add("unknown method", err, "")
+		return checks
+	case err == nil:
+		add("unknown method", fmt.Errorf("The plugin accepted an unknown method"), "")
+	default:
+		add("unknown method", nil, fmt.Sprintf("Answered with: %s", err))
+	}
+
+	if r.supports(PluginList) {
+		resp, err := r.call(ctx, &PluginRequest{Method: PluginList, List: &PluginListParams{ID: 1, Page: 1, PerPage: 10}})
+		if err == nil && resp.NextPage != 0 && resp.NextPage <= 1 {
+			err = fmt.Errorf("Next page %d after page 1", resp.NextPage)
+		}
+		if err == nil {
+			for _, repo := range resp.Repositories {
+				if repo == nil || repo.Name == "" {
+					err = fmt.Errorf("Repository without a name on page 1")
+					break
+				}
+			}
+		}
+		add(PluginList, err, fmt.Sprintf("%d repositories on page 1", len(resp.repositories())))
+	} else {
+		skip(PluginList, "Not supported by the plugin")
+	}
+
+	name := fmt.Sprintf("gitrc-plugin-check-%d", time.Now().Unix())
+	for _, m := range []string{PluginCreate, PluginCloneURL, PluginDelete} {
+		if !write {
+			skip(m, "Only checked with write access")
+			continue
+		}
+		if !r.supports(m) {
+			skip(m, "Not supported by the plugin")
+			continue
+		}
+
+		switch m {
+		case PluginCreate:
+			repo, err := r.CreateRepo(ctx, name, nil)
+			add(m, err, fmt.Sprintf("Created %s", name))
+			if err == nil && repo.Name == "" {
+				checks[len(checks)-1].Result = PluginCheckFailed
+				checks[len(checks)-1].Message = "Created repository has no name"
+			}
+		case PluginCloneURL:
+			for _, protocol := range []string{"ssh", "http"} {
+				resp, err := r.call(ctx, &PluginRequest{Method: PluginCloneURL, Name: name, Protocol: protocol})
+				if err == nil {
+					_, err = transport.NewEndpoint(resp.URL)
+				}
+				add(m+" "+protocol, err, fmt.Sprintf("Resolved %s", resp.url()))
+			}
+		case PluginDelete:
+			err := r.DeleteRepo(ctx, name)
+			add(m, err, fmt.Sprintf("Deleted %s", name))
+			err = r.DeleteRepo(ctx, name)
+			if err == nil {
+				add(m+" missing", fmt.Errorf("Deleting the deleted repository %s succeeded", name), "")
+			} else {
+				add(m+" missing", nil, fmt.Sprintf("Answered with: %s", err))
+			}
+		}
+	}
+
+	return checks
+}
+
+// repositories returns the repositories of a response, which may be nil
+func (resp *PluginResponse) repositories() []*Repository {
+	if resp == nil {
+		return nil
+	}
+	return resp.Repositories
+}
+
+// url returns the url of a response, which may be nil
+func (resp *PluginResponse) url() string {
+	if resp == nil {
+		return ""
+	}
+	return resp.URL
+}
+
+// NewPluginRemote creates a new Remote object for the plugin at path and returns it
+func NewPluginRemote(path string, p Provider) (*PluginRemote, error) {
+
+	remote := new(PluginRemote)
+
+	remote.Provider = p
+	remote.Path = path
+
+	return remote, nil
+}
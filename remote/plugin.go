@@ -0,0 +1,273 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// PluginProtocolVersion is the version of the plugin protocol spoken by this package.
+// Requests and responses carry the version, plugins answer requests of other versions with an error.
+const PluginProtocolVersion = 1
+
+// PluginPrefix is the prefix of the executables of provider plugins, e.g. gitrc-provider-myforge for the type myforge
+const PluginPrefix = "gitrc-provider-"
+
+// Methods of the plugin protocol
+const (
+	PluginHandshake = "handshake"
+	PluginCreate    = "create"
+	PluginList      = "list"
+	PluginDelete    = "delete"
+	PluginCloneURL  = "clone_url"
+)
+
+// PluginMethods contains all methods of the plugin protocol
+var PluginMethods = []string{PluginHandshake, PluginCreate, PluginList, PluginDelete, PluginCloneURL}
+
+// PluginRequest is a request of gitrc to a plugin.
+// The plugin is started once, requests are written to its stdin as one json object per line.
+// The first request is a handshake, which passes the settings of the remote.
+type PluginRequest struct {
+	Version int    `json:"version"`
+	Method  string `json:"method"`
+
+	// Provider contains the settings of the remote, it is sent with the handshake
+	Provider *Provider `json:"provider,omitempty"`
+	// Name is the repository to create, delete or resolve the clone url of
+	Name string `json:"name,omitempty"`
+	// Visibility is the visibility of a new repository
+	Visibility Visibility `json:"visibility,omitempty"`
+	// Protocol is the clone protocol, ssh or http
+	Protocol string `json:"protocol,omitempty"`
+	// List contains the parameters of a list request
+	List *PluginListParams `json:"list,omitempty"`
+}
+
+// PluginListParams contains the parameters of a list request.
+// The pages of a listing are requested in order, starting with page 1.
+type PluginListParams struct {
+	// ID identifies the listing, the plugin may keep state between its pages
+	ID               int    `json:"id"`
+	Owner            string `json:"owner,omitempty"`
+	Type             string `json:"type,omitempty"`
+	IncludeSubgroups bool   `json:"include_subgroups,omitempty"`
+	Page             int    `json:"page"`
+	PerPage          int    `json:"per_page"`
+}
+
+// PluginResponse is the response of a plugin, it is written to stdout as one json object per line.
+// Failed requests are answered with an error, the plugin keeps running.
+type PluginResponse struct {
+	Version int    `json:"version"`
+	Error   string `json:"error,omitempty"`
+
+	// Methods are the methods supported by the plugin, they are returned by the handshake
+	Methods []string `json:"methods,omitempty"`
+	// Repository is the created repository
+	Repository *Repository `json:"repository,omitempty"`
+	// Repositories is a page of a listing
+	Repositories []*Repository `json:"repositories,omitempty"`
+	// NextPage is the number of the next page of a listing, 0 after the last page
+	NextPage int `json:"next_page,omitempty"`
+	// URL is the clone url of a repository
+	URL string `json:"url,omitempty"`
+	// User and Password authenticate http clones, gitrc falls back to the settings of the remote
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// CloneURLResolver is implemented by remotes, which can resolve the clone url of a repository directly.
+// Remotes served as plugin without it are searched for the repository in their listing.
+type CloneURLResolver interface {
+	// Function CloneURL returns the url to clone the repository name with the given protocol (ssh or http)
+	CloneURL(ctx context.Context, name, protocol string) (string, error)
+}
+
+// ServePlugin serves the plugin protocol on stdin and stdout with the remote created by f.
+// It is the main function of provider plugins and returns, when gitrc closes stdin:
+//
+//	func main() {
+//		remote.ServePlugin(func(p remote.Provider) (remote.Remote, error) { return NewMyRemote(p) })
+//	}
+func ServePlugin(f NewFunc) {
+
+	err := servePlugin(context.Background(), f, os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+// pluginServer answers the requests of gitrc with a remote
+type pluginServer struct {
+	newRemote NewFunc
+	remote    Remote
+	lists     map[int]*RepoIterator
+}
+
+// servePlugin answers the requests read from in until it is closed
+func servePlugin(ctx context.Context, f NewFunc, in io.Reader, out io.Writer) error {
+
+	s := &pluginServer{newRemote: f, lists: make(map[int]*RepoIterator)}
+	dec := json.NewDecoder(in)
+	enc := json.NewEncoder(out)
+
+	for {
+		req := new(PluginRequest)
+		err := dec.Decode(req)
+		if err == io.EOF {
+			return nil
+		}
+
+		resp := &PluginResponse{Version: PluginProtocolVersion}
+		if err != nil {
+			// The stream can't be read any further after invalid json
+			resp.Error = fmt.Sprintf("Invalid request: %s", err)
+			enc.Encode(resp)
+			return err
+		}
+
+		err = s.handle(ctx, req, resp)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+
+		err = enc.Encode(resp)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a single request
+func (s *pluginServer) handle(ctx context.Context, req *PluginRequest, resp *PluginResponse) error {
+
+	if req.Version != PluginProtocolVersion {
+		return fmt.Errorf("Unsupported protocol version %d, the plugin speaks version %d", req.Version, PluginProtocolVersion)
+	}
+
+	if req.Method == PluginHandshake {
+		if req.Provider == nil {
+			return fmt.Errorf("No provider settings in the handshake")
+		}
+		r, err := s.newRemote(*req.Provider)
+		if err != nil {
+			return err
+		}
+		s.remote = r
+		resp.Methods = PluginMethods
+		return nil
+	}
+
+	if s.remote == nil {
+		return fmt.Errorf("No handshake before %s", req.Method)
+	}
+
+	switch req.Method {
+	case PluginCreate:
+		repo, err := s.remote.CreateRepo(ctx, req.Name, &CreateOptions{Visibility: req.Visibility})
+		if err != nil {
+			return err
+		}
+		resp.Repository = repo
+	case PluginDelete:
+		return s.remote.DeleteRepo(ctx, req.Name)
+	case PluginList:
+		return s.list(ctx, req.List, resp)
+	case PluginCloneURL:
+		url, err := s.cloneURL(ctx, req.Name, req.Protocol)
+		if err != nil {
+			return err
+		}
+		resp.URL = url
+	default:
+		return fmt.Errorf("Unknown method %s", req.Method)
+	}
+
+	return nil
+}
+
+// list answers a list request with a page of the listing.
+// The iterator of a listing is kept until its last page, because providers may need the previous pages, e.g. for cursors.
+func (s *pluginServer) list(ctx context.Context, l *PluginListParams, resp *PluginResponse) error {
+
+	if l == nil {
+		return fmt.Errorf("No list parameters")
+	}
+
+	// A new iterator would start over, so later pages are only answered by the iterator of their listing
+	it := s.lists[l.ID]
+	switch {
+	case l.Page <= 1:
+		it = s.remote.ListRepos(ctx, &ListOptions{Owner: l.Owner, Type: l.Type, IncludeSubgroups: l.IncludeSubgroups})
+		s.lists[l.ID] = it
+	case it == nil:
+		return fmt.Errorf("Unknown listing %d, listings start with page 1", l.ID)
+	case l.Page != it.page:
+		delete(s.lists, l.ID)
+		return fmt.Errorf("Page %d of listing %d requested, but the next page is %d", l.Page, l.ID, it.page)
+	}
+	if it.err != nil {
+		delete(s.lists, l.ID)
+		return it.err
+	}
+
+	repos, next, err := it.fetch(ctx, it.page, l.PerPage)
+	it.page = next
+	if err != nil || next == 0 {
+		delete(s.lists, l.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	resp.Repositories = repos
+	resp.NextPage = next
+
+	return nil
+}
+
+// cloneURL returns the clone url of the repository name
+func (s *pluginServer) cloneURL(ctx context.Context, name, protocol string) (string, error) {
+
+	if r, ok := s.remote.(CloneURLResolver); ok {
+		return r.CloneURL(ctx, name, protocol)
+	}
+
+	owner, _ := splitName(name)
+	it := s.remote.ListRepos(ctx, &ListOptions{Owner: owner})
+	for {
+		r, err := it.Next()
+		if err == Done {
+			return "", fmt.Errorf("Repository %s not found", name)
+		}
+		if err != nil {
+			return "", err
+		}
+		if r.FullName == name || r.Name == name {
+			if r.CloneURL(protocol) == "" {
+				return "", fmt.Errorf("Repository %s has no %s clone url", name, protocol)
+			}
+			return r.CloneURL(protocol), nil
+		}
+	}
+}
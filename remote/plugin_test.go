@@ -0,0 +1,166 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// cursorRemote lists its repositories by cursors, which are only known from the previous page
+type cursorRemote struct {
+	names []string
+}
+
+func (c *cursorRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+	return nil, fmt.Errorf("Not supported")
+}
+
+func (c *cursorRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+	return fmt.Errorf("Not supported")
+}
+
+func (c *cursorRemote) DeleteRepo(ctx context.Context, name string) error {
+	return fmt.Errorf("Not supported")
+}
+
+func (c *cursorRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	cursors := map[int]int{1: 0}
+
+	return NewRepoIterator(ctx, opts, 2, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		start, ok := cursors[page]
+		if !ok {
+			return nil, 0, fmt.Errorf("No cursor for page %d", page)
+		}
+
+		repos := []*Repository{}
+		for i := start; i < len(c.names) && i < start+perPage; i++ {
+			repos = append(repos, &Repository{FullName: c.names[i]})
+		}
+		if start+perPage >= len(c.names) {
+			return repos, 0, nil
+		}
+		cursors[page+1] = start + perPage
+
+		return repos, page + 1, nil
+	})
+}
+
+// servePluginRequests answers the requests with a plugin serving a cursorRemote and returns the responses
+func servePluginRequests(t *testing.T, reqs ...*PluginRequest) []*PluginResponse {
+
+	in := new(bytes.Buffer)
+	enc := json.NewEncoder(in)
+	enc.Encode(&PluginRequest{Version: PluginProtocolVersion, Method: PluginHandshake, Provider: &Provider{}})
+	for _, req := range reqs {
+		req.Version = PluginProtocolVersion
+		enc.Encode(req)
+	}
+
+	out := new(bytes.Buffer)
+	f := func(p Provider) (Remote, error) {
+		return &cursorRemote{names: []string{"a", "b", "c", "d", "e"}}, nil
+	}
+	if err := servePlugin(context.Background(), f, in, out); err != nil {
+		t.Fatal(err)
+	}
+
+	resps := []*PluginResponse{}
+	dec := json.NewDecoder(out)
+	for {
+		resp := new(PluginResponse)
+		err := dec.Decode(resp)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, resp)
+	}
+	if len(resps) != len(reqs)+1 || resps[0].Error != "" {
+		t.Fatalf("Got %d responses to %d requests", len(resps), len(reqs)+1)
+	}
+
+	return resps[1:]
+}
+
+// listPage requests a page of a listing
+func listPage(id, page int) *PluginRequest {
+	return &PluginRequest{Method: PluginList, List: &PluginListParams{ID: id, Page: page, PerPage: 2}}
+}
+
+// pageNames returns the names of the repositories of a response
+func pageNames(resp *PluginResponse) string {
+
+	names := []string{}
+	for _, r := range resp.Repositories {
+		names = append(names, r.FullName)
+	}
+
+	return strings.Join(names, ",")
+}
+
+func TestPluginListPages(t *testing.T) {
+
+	resps := servePluginRequests(t, listPage(1, 1), listPage(1, 2), listPage(1, 3))
+
+	want := []string{"a,b", "c,d", "e"}
+	for i, resp := range resps {
+		if resp.Error != "" {
+			t.Fatalf("Page %d failed: %s", i+1, resp.Error)
+		}
+		if pageNames(resp) != want[i] {
+			t.Errorf("Page %d contains %s, want %s", i+1, pageNames(resp), want[i])
+		}
+	}
+	if resps[0].NextPage != 2 || resps[1].NextPage != 3 || resps[2].NextPage != 0 {
+		t.Errorf("Next pages are %d, %d, %d, want 2, 3, 0", resps[0].NextPage, resps[1].NextPage, resps[2].NextPage)
+	}
+}
+
+func TestPluginListUnknownPages(t *testing.T) {
+
+	resps := servePluginRequests(t,
+		// A later page of an unknown listing would start over
+		listPage(1, 2),
+		// Pages are requested in order
+		listPage(2, 1), listPage(2, 3),
+		// The listing is dropped after a page out of order
+		listPage(2, 2),
+		// The listing is dropped after its last page
+		listPage(3, 1), listPage(3, 2), listPage(3, 3), listPage(3, 3),
+	)
+
+	for _, i := range []int{0, 2, 3, 7} {
+		if resps[i].Error == "" || len(resps[i].Repositories) != 0 {
+			t.Errorf("Request %d returned %s without an error", i+1, pageNames(resps[i]))
+		}
+	}
+	for _, i := range []int{1, 4, 5, 6} {
+		if resps[i].Error != "" {
+			t.Errorf("Request %d failed: %s", i+1, resps[i].Error)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// NewFunc creates a new Remote from the settings of a provider
+type NewFunc func(p Provider) (Remote, error)
+
+// Capabilities describes what a provider supports independently of its settings.
+// Optional operations on existing repositories are found by type assertion, see FeaturesOf.
+type Capabilities struct {
+	// Visibilities of new repositories, empty if repositories inherit their visibility, e.g. from a project
+	Visibilities []Visibility `json:"visibilities" yaml:"visibilities"`
+	// Protocols are the supported clone protocols
+	Protocols []string `json:"protocols" yaml:"protocols"`
+	// ListTypes are the types listings can be filtered by, empty if listings can't be filtered
+	ListTypes []string `json:"list_types" yaml:"list_types"`
+	// Subgroups is true, if listings can include the repositories of nested groups
+	Subgroups bool `json:"subgroups" yaml:"subgroups"`
+	// ListOrder is the order of listings, one of the ListOrder constants, empty if the order is unspecified
+	ListOrder string `json:"list_order" yaml:"list_order"`
+}
+
+// Orders of listings
+const (
+	// ListOrderUpdated lists the most recently updated repositories first
+	ListOrderUpdated = "updated"
+	// ListOrderName lists the repositories sorted by their full name
+	ListOrderName = "name"
+)
+
+// Features contains the optional interfaces implemented by a remote
+type Features struct {
+	SetVisibility bool `json:"set_visibility" yaml:"set_visibility"`
+	Archive       bool `json:"archive" yaml:"archive"`
+	Rename        bool `json:"rename" yaml:"rename"`
+	Fork          bool `json:"fork" yaml:"fork"`
+}
+
+// FeaturesOf returns the optional interfaces implemented by r
+func FeaturesOf(r Remote) Features {
+
+	var f Features
+	_, f.SetVisibility = r.(VisibilitySetter)
+	_, f.Archive = r.(Archiver)
+	_, f.Rename = r.(Renamer)
+	_, f.Fork = r.(Forker)
+
+	return f
+}
+
+// provider is a registered provider
+type provider struct {
+	newFunc      NewFunc
+	capabilities Capabilities
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]provider)
+)
+
+// Register makes a provider available by name with its capabilities.
+// Register panics if it is called twice for the same name or if f is nil.
+func Register(name string, f NewFunc, caps Capabilities) {
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if f == nil {
+		panic("remote: Register function is nil for provider " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("remote: Register called twice for provider " + name)
+	}
+	registry[name] = provider{newFunc: f, capabilities: caps}
+}
+
+// Providers returns the sorted names of all registered providers
+func Providers() []string {
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ProviderCapabilities returns the capabilities of the registered provider name.
+// The capabilities of plugins are unknown, ok is false for them.
+func ProviderCapabilities(name string) (caps Capabilities, ok bool) {
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	pr, ok := registry[name]
+
+	return pr.capabilities, ok
+}
+
+// New creates a new Remote for the registered provider name or the plugin gitrc-provider-<name>
+func New(name string, p Provider) (Remote, error) {
+
+	registryMu.RLock()
+	pr, ok := registry[name]
+	registryMu.RUnlock()
+
+	// Unknown providers may be served by a plugin
+	if !ok {
+		path, err := FindPlugin(name)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown provider: %s, provider can be one of: %s or a plugin %s%s on PATH", name, Providers(), PluginPrefix, name)
+		}
+		return NewPluginRemote(path, p)
+	}
+
+	return pr.newFunc(p)
+}
@@ -0,0 +1,383 @@
+/*
+   Copyright 2018 Wilhelm Peter Püschel
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package remote provides a common interface to manage repositories on remote git providers
+// like GitHub, GitLab and Gitea.
+//
+// Providers register themselves by name, a Remote is created with New or from a Config:
+//
+//	config, err := remote.NewConfig(remote.DefaultConfigFile())
+//	...
+//	r, err := config.Remote("github")
+//	...
+//	repos, err := r.ListRepos(ctx, nil).All()
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// Remote is a client for a remote git provider.
+// All requests and clones are aborted, when the context is cancelled.
+// Repository names may be prefixed with their owner, e.g. "org/name".
+type Remote interface {
+	// Function CreateRepo creates a new remote repository with a basic README.md
+	CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error)
+	// Function CloneRepo clones the remote repository
+	CloneRepo(ctx context.Context, name string, opts *CloneOptions) error
+	// Functon DeleteRepo deletes a remote repository
+	DeleteRepo(ctx context.Context, name string) error
+	// Function ListRepos list all remote repositories page by page
+	ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator
+}
+
+// VisibilitySetter is implemented by remotes, which can change the visibility of existing repositories
+type VisibilitySetter interface {
+	// Function SetVisibility changes the visibility of the remote repository name
+	SetVisibility(ctx context.Context, name string, visibility Visibility) error
+}
+
+// Archiver is implemented by remotes, which can archive repositories. Archived repositories are read-only.
+type Archiver interface {
+	// Function ArchiveRepo archives the remote repository name or, if archived is false, unarchives it
+	ArchiveRepo(ctx context.Context, name string, archived bool) error
+}
+
+// Renamer is implemented by remotes, which can rename repositories.
+// Repositories keep their owner, so the new name has no owner.
+type Renamer interface {
+	// Function RenameRepo renames the remote repository name to newName
+	RenameRepo(ctx context.Context, name, newName string) error
+}
+
+// Forker is implemented by remotes, which can fork repositories
+type Forker interface {
+	// Function ForkRepo forks the remote repository name into owner or, if owner is empty, to the user
+	ForkRepo(ctx context.Context, name, owner string) (*Repository, error)
+}
+
+// CreateOptions contains the options for the creation of a repository
+type CreateOptions struct {
+	// Visibility of the new repository, it defaults to the visibility configured for the remote or private
+	Visibility Visibility
+}
+
+// visibility returns the visibility of a new repository on the remote configured by p
+func (o *CreateOptions) visibility(p Provider) (Visibility, error) {
+
+	v := p.Visibility
+	if o != nil && o.Visibility != "" {
+		v = o.Visibility
+	}
+	if v == "" {
+		return VisibilityPrivate, nil
+	}
+
+	return ParseVisibility(string(v))
+}
+
+// CloneOptions contains the options for cloning a repository
+type CloneOptions struct {
+	// Dir is the directory to clone into, it defaults to the name of the repository without its owner
+	Dir string
+	// Progress receives the progress messages of the clone, if set
+	Progress io.Writer
+}
+
+// dir returns the directory to clone the repository name into
+func (o *CloneOptions) dir(name string) string {
+	if o == nil || o.Dir == "" {
+		_, name = splitName(name)
+		return name
+	}
+	return o.Dir
+}
+
+// progress returns the writer for progress messages, which may be nil
+func (o *CloneOptions) progress() io.Writer {
+	if o == nil {
+		return nil
+	}
+	return o.Progress
+}
+
+// Visibility of a repository.
+// Internal repositories are visible to all users of the provider instance or organisation.
+type Visibility string
+
+// Visibilities of a repository
+const (
+	VisibilityPublic   Visibility = "public"
+	VisibilityInternal Visibility = "internal"
+	VisibilityPrivate  Visibility = "private"
+)
+
+// Visibilities contains all visibilities
+var Visibilities = []Visibility{VisibilityPublic, VisibilityInternal, VisibilityPrivate}
+
+// ParseVisibility returns the visibility named s
+func ParseVisibility(s string) (Visibility, error) {
+
+	for _, v := range Visibilities {
+		if string(v) == s {
+			return v, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unknown visibility %s, visibility can be one of: %s", s, Visibilities)
+}
+
+// checkNewName checks the new name of a renamed repository, which must not have an owner
+func checkNewName(newName string) error {
+
+	if owner, _ := splitName(newName); owner != "" || newName == "" {
+		return fmt.Errorf("Invalid new name %s, repositories are renamed within their owner", newName)
+	}
+
+	return nil
+}
+
+// unsupportedVisibility returns the error for a visibility, which the provider typ does not support
+func unsupportedVisibility(typ string, v Visibility) error {
+	return fmt.Errorf("Visibility %s is not supported by %s", v, typ)
+}
+
+// Repository is the provider independent representation of a remote repository
+type Repository struct {
+	Name          string     `json:"name" yaml:"name"`
+	FullName      string     `json:"full_name" yaml:"full_name"`
+	Visibility    Visibility `json:"visibility" yaml:"visibility"`
+	DefaultBranch string     `json:"default_branch" yaml:"default_branch"`
+	SSHURL        string     `json:"ssh_url" yaml:"ssh_url"`
+	HTTPURL       string     `json:"http_url" yaml:"http_url"`
+	WebURL        string     `json:"web_url" yaml:"web_url"`
+	Created       time.Time  `json:"created_at" yaml:"created_at"`
+	Updated       time.Time  `json:"updated_at" yaml:"updated_at"`
+	Archived      bool       `json:"archived" yaml:"archived"`
+	Size          int64      `json:"size" yaml:"size"` // Size of the repository in KiB
+}
+
+// CloneURL returns the URL to clone the repository with the given protocol (ssh or http)
+func (r *Repository) CloneURL(protocol string) string {
+	if protocol == "http" {
+		return r.HTTPURL
+	}
+	return r.SSHURL
+}
+
+// sshAuth returns the authentication for ssh endpoints.
+// The configured ssh key file is used, without one go-git falls back to the ssh-agent.
+func sshAuth(p Provider, endpoint *transport.Endpoint) (transport.AuthMethod, error) {
+
+	if endpoint.Protocol != "ssh" || p.SSHKeyFile == "" {
+		return nil, nil
+	}
+
+	user := endpoint.User
+	if user == "" {
+		user = "git"
+	}
+
+	auth, err := gitssh.NewPublicKeysFromFile(user, p.SSHKeyFile, "")
+	if err != nil {
+		return nil, fmt.Errorf("Could not read ssh key %s: %s", p.SSHKeyFile, err)
+	}
+
+	return auth, nil
+}
+
+// cloneEndpoint clones the repository name from endpoint according to opts, auth may be nil.
+// If the clone fails or is cancelled, everything written to the clone directory is removed.
+func cloneEndpoint(ctx context.Context, endpoint *transport.Endpoint, auth transport.AuthMethod, name string, opts *CloneOptions) error {
+
+	dir := opts.dir(name)
+
+	progress := opts.progress()
+	if progress != nil {
+		fmt.Fprintf(progress, "Cloning %s://%s%s\n", endpoint.Protocol, endpoint.Host, endpoint.Path)
+	}
+
+	// Remember what was there before, so we can clean up a failed clone
+	existed := true
+	before := make(map[string]bool)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		existed = false
+	} else if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		before[e.Name()] = true
+	}
+
+	// Clone the repository
+	_, err = git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:               endpoint.String(),
+		Auth:              auth,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		Progress:          progress,
+	})
+	if err == nil {
+		return nil
+	}
+
+	// Remove the half-written clone
+	if !existed {
+		os.RemoveAll(dir)
+		return err
+	}
+	entries, _ = ioutil.ReadDir(dir)
+	for _, e := range entries {
+		if !before[e.Name()] {
+			os.RemoveAll(filepath.Join(dir, e.Name()))
+		}
+	}
+
+	return err
+}
+
+// commitReadme commits a basic README for the repository name to the master branch of repo, the author defaults to gitrc.
+// The objects are written to the storage directly, so repo may be bare.
+func commitReadme(repo *git.Repository, author, name string) error {
+
+	s := repo.Storer
+
+	blob := s.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	w, err := blob.Writer()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "# %s\n", name)
+	w.Close()
+	blobHash, err := s.SetEncodedObject(blob)
+	if err != nil {
+		return err
+	}
+
+	tree := &object.Tree{Entries: []object.TreeEntry{{Name: "README.md", Mode: filemode.Regular, Hash: blobHash}}}
+	treeObject := s.NewEncodedObject()
+	err = tree.Encode(treeObject)
+	if err != nil {
+		return err
+	}
+	treeHash, err := s.SetEncodedObject(treeObject)
+	if err != nil {
+		return err
+	}
+
+	if author == "" {
+		author = "gitrc"
+	}
+	signature := object.Signature{Name: author, When: time.Now()}
+	commit := &object.Commit{Author: signature, Committer: signature, Message: "Added a README\n", TreeHash: treeHash}
+	commitObject := s.NewEncodedObject()
+	err = commit.Encode(commitObject)
+	if err != nil {
+		return err
+	}
+	commitHash, err := s.SetEncodedObject(commitObject)
+	if err != nil {
+		return err
+	}
+
+	return s.SetReference(plumbing.NewHashReference(plumbing.Master, commitHash))
+}
+
+// pushReadme pushes the initial commit of a basic README for the repository name to the empty repository at url.
+// The commit is created in memory, so no local clone is needed.
+func pushReadme(ctx context.Context, url string, auth transport.AuthMethod, author, name string) error {
+
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return err
+	}
+
+	err = commitReadme(repo, author, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}})
+	if err != nil {
+		return err
+	}
+
+	err = repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{"refs/heads/master:refs/heads/master"},
+		Auth:       auth,
+	})
+	if err != nil {
+		return fmt.Errorf("Could not push the README to %s: %s", url, err)
+	}
+
+	return nil
+}
+
+// checkName checks that the path elements of a repository name are neither empty nor relative
+func checkName(name string) error {
+
+	for _, e := range strings.Split(name, "/") {
+		if e == "" || e == "." || e == ".." {
+			return fmt.Errorf("Invalid repository name %s", name)
+		}
+	}
+
+	return nil
+}
+
+// splitName splits a repository name given as "owner/name" into owner and name.
+// The owner is empty, if name contains no owner.
+func splitName(name string) (string, string) {
+
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return "", name
+	}
+
+	return name[:i], name[i+1:]
+}
+
+// sleep waits for the duration d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
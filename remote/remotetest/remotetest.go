@@ -0,0 +1,385 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package remotetest provides a conformance suite for implementations of remote.Remote.
+// The suite runs against a fake or a real backend and checks that a remote behaves like all others:
+//
+//	func TestGitea(t *testing.T) {
+//		caps, _ := remote.ProviderCapabilities("gitea")
+//		remotetest.Run(t, caps, func(t *testing.T) remote.Remote {
+//			s := fakeforge.New(fakeforge.Gitea, "alice")
+//			t.Cleanup(s.Close)
+//			r, err := remote.New("gitea", s.Provider())
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return r
+//		})
+//	}
+//
+// The repositories created by the suite are named gitrc-conformance-* and deleted, when the tests are finished.
+package remotetest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wpueschel/gitrc/remote"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Prefix is the prefix of the names of all repositories created by the suite
+const Prefix = "gitrc-conformance-"
+
+// Factory returns the remote under test, it is called once for every test of the suite.
+// The remote must be able to create repositories of all visibilities of the capabilities,
+// e.g. a GitHub remote needs an organisation as owner for internal repositories.
+type Factory func(t *testing.T) remote.Remote
+
+// suite is a single run of the conformance suite
+type suite struct {
+	caps      remote.Capabilities
+	newRemote Factory
+	run       string
+}
+
+// Run runs the conformance suite against the remotes returned by newRemote.
+// The visibilities and the list order the suite expects are those of caps.
+func Run(t *testing.T, caps remote.Capabilities, newRemote Factory) {
+
+	s := &suite{
+		caps:      caps,
+		newRemote: newRemote,
+		run:       strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+
+	t.Run("Create", s.testCreate)
+	t.Run("CreateDuplicate", s.testCreateDuplicate)
+	t.Run("Visibility", s.testVisibility)
+	t.Run("List", s.testList)
+	t.Run("Delete", s.testDelete)
+}
+
+// testCreate checks that a new repository has a single commit with a README and is listed
+func (s *suite) testCreate(t *testing.T) {
+
+	r := s.newRemote(t)
+	name := s.name("create")
+
+	repo := s.create(t, r, name, nil)
+	if repo.Name != name {
+		t.Errorf("Created repository has the name %s, want %s", repo.Name, name)
+	}
+	if repo.FullName != name && !strings.HasSuffix(repo.FullName, "/"+name) {
+		t.Errorf("Created repository has the full name %s, want %s with an optional owner", repo.FullName, name)
+	}
+	if len(s.caps.Visibilities) > 0 && !hasVisibility(s.caps.Visibilities, repo.Visibility) {
+		t.Errorf("Created repository has the visibility %q, want one of %s", repo.Visibility, s.caps.Visibilities)
+	}
+	for _, protocol := range s.caps.Protocols {
+		if repo.CloneURL(protocol) == "" {
+			t.Errorf("Created repository has no clone URL for %s", protocol)
+		}
+	}
+
+	s.checkClone(t, r, repo)
+
+	listed := find(s.list(t, r, nil), repo.FullName)
+	if len(listed) != 1 {
+		t.Fatalf("Created repository %s is listed %d times, want once", repo.FullName, len(listed))
+	}
+	if listed[0].Visibility != repo.Visibility {
+		t.Errorf("Listed repository %s has the visibility %s, the created one %s", repo.FullName, listed[0].Visibility, repo.Visibility)
+	}
+}
+
+// testCreateDuplicate checks that creating an existing repository fails and leaves the repository unchanged
+func (s *suite) testCreateDuplicate(t *testing.T) {
+
+	r := s.newRemote(t)
+	name := s.name("duplicate")
+
+	repo := s.create(t, r, name, nil)
+	dup, err := r.CreateRepo(context.Background(), name, nil)
+	if err == nil {
+		t.Fatalf("Creating the existing repository %s succeeded with %+v, want an error", name, dup)
+	}
+
+	if n := len(find(s.list(t, r, nil), repo.FullName)); n != 1 {
+		t.Errorf("Repository %s is listed %d times after a duplicate create, want once", repo.FullName, n)
+	}
+	s.checkClone(t, r, repo)
+}
+
+// testVisibility checks that repositories are created with all visibilities of the capabilities
+// and, if the remote can change visibilities, that the change is listed
+func (s *suite) testVisibility(t *testing.T) {
+
+	if len(s.caps.Visibilities) == 0 {
+		t.Skip("Repositories inherit their visibility")
+	}
+
+	r := s.newRemote(t)
+	ctx := context.Background()
+
+	created := []*remote.Repository{}
+	for _, v := range s.caps.Visibilities {
+		repo := s.create(t, r, s.name("visibility-"+string(v)), &remote.CreateOptions{Visibility: v})
+		if repo.Visibility != v {
+			t.Errorf("Repository %s was created with the visibility %s, want %s", repo.FullName, repo.Visibility, v)
+		}
+		created = append(created, repo)
+	}
+
+	repos := s.list(t, r, nil)
+	for _, repo := range created {
+		listed := find(repos, repo.FullName)
+		if len(listed) != 1 {
+			t.Errorf("Repository %s is listed %d times, want once", repo.FullName, len(listed))
+			continue
+		}
+		if listed[0].Visibility != repo.Visibility {
+			t.Errorf("Repository %s is listed with the visibility %s, want %s", repo.FullName, listed[0].Visibility, repo.Visibility)
+		}
+	}
+
+	setter, ok := r.(remote.VisibilitySetter)
+	if !ok || len(s.caps.Visibilities) < 2 {
+		return
+	}
+
+	// Rotate the visibilities, so every repository gets another one
+	for i, repo := range created {
+		v := s.caps.Visibilities[(i+1)%len(s.caps.Visibilities)]
+		if err := setter.SetVisibility(ctx, repo.FullName, v); err != nil {
+			t.Errorf("Could not change the visibility of %s to %s: %s", repo.FullName, v, err)
+			continue
+		}
+		repo.Visibility = v
+	}
+
+	repos = s.list(t, r, nil)
+	for _, repo := range created {
+		for _, listed := range find(repos, repo.FullName) {
+			if listed.Visibility != repo.Visibility {
+				t.Errorf("Repository %s is listed with the visibility %s after the change, want %s", repo.FullName, listed.Visibility, repo.Visibility)
+			}
+		}
+	}
+}
+
+// testList checks that listings contain every repository once, are in the order of the capabilities and honour the limit
+func (s *suite) testList(t *testing.T) {
+
+	r := s.newRemote(t)
+	ctx := context.Background()
+
+	first := s.create(t, r, s.name("list-a"), nil)
+	second := s.create(t, r, s.name("list-b"), nil)
+
+	repos := s.list(t, r, nil)
+	seen := map[string]bool{}
+	for _, repo := range repos {
+		if seen[repo.FullName] {
+			t.Errorf("Repository %s is listed more than once", repo.FullName)
+		}
+		seen[repo.FullName] = true
+	}
+	for _, repo := range []*remote.Repository{first, second} {
+		if !seen[repo.FullName] {
+			t.Errorf("Repository %s is not listed", repo.FullName)
+		}
+	}
+
+	for i := 1; i < len(repos); i++ {
+		prev, cur := repos[i-1], repos[i]
+		switch s.caps.ListOrder {
+		case remote.ListOrderUpdated:
+			if cur.Updated.After(prev.Updated) {
+				t.Errorf("Repository %s (updated %s) is listed after %s (updated %s), want the most recently updated first",
+					cur.FullName, cur.Updated, prev.FullName, prev.Updated)
+			}
+		case remote.ListOrderName:
+			if cur.FullName < prev.FullName {
+				t.Errorf("Repository %s is listed after %s, want the repositories sorted by name", cur.FullName, prev.FullName)
+			}
+		}
+	}
+
+	limited := s.list(t, r, &remote.ListOptions{Limit: 1})
+	if len(limited) != 1 {
+		t.Errorf("Listing with limit 1 returned %d repositories", len(limited))
+	} else if limited[0].FullName != repos[0].FullName {
+		t.Errorf("Listing with limit 1 returned %s, want the first repository %s", limited[0].FullName, repos[0].FullName)
+	}
+
+	// An exhausted iterator stays exhausted
+	it := r.ListRepos(ctx, &remote.ListOptions{Limit: 1})
+	it.Next()
+	for i := 0; i < 2; i++ {
+		if repo, err := it.Next(); err != remote.Done {
+			t.Errorf("Next after the limit returned %v, %v, want remote.Done", repo, err)
+		}
+	}
+}
+
+// testDelete checks that deleted repositories are no longer listed and that deleting missing repositories fails
+func (s *suite) testDelete(t *testing.T) {
+
+	r := s.newRemote(t)
+	ctx := context.Background()
+	name := s.name("delete")
+
+	repo := s.create(t, r, name, nil)
+	if err := r.DeleteRepo(ctx, name); err != nil {
+		t.Fatalf("Could not delete %s: %s", name, err)
+	}
+	if n := len(find(s.list(t, r, nil), repo.FullName)); n != 0 {
+		t.Errorf("Deleted repository %s is still listed", repo.FullName)
+	}
+
+	if err := r.DeleteRepo(ctx, name); err == nil {
+		t.Errorf("Deleting the deleted repository %s succeeded, want an error", name)
+	}
+	if err := r.DeleteRepo(ctx, s.name("missing")); err == nil {
+		t.Errorf("Deleting the missing repository %s succeeded, want an error", s.name("missing"))
+	}
+}
+
+// name returns the name of a repository of this run
+func (s *suite) name(suffix string) string {
+	return fmt.Sprintf("%s%s-%s", Prefix, s.run, suffix)
+}
+
+// create creates a repository, which is deleted after the test
+func (s *suite) create(t *testing.T, r remote.Remote, name string, opts *remote.CreateOptions) *remote.Repository {
+
+	t.Helper()
+
+	repo, err := r.CreateRepo(context.Background(), name, opts)
+	if err != nil {
+		t.Fatalf("Could not create %s: %s", name, err)
+	}
+	if repo == nil {
+		t.Fatalf("Creating %s returned no repository", name)
+	}
+	t.Cleanup(func() {
+		r.DeleteRepo(context.Background(), name)
+	})
+
+	return repo
+}
+
+// list returns all repositories of a listing
+func (s *suite) list(t *testing.T, r remote.Remote, opts *remote.ListOptions) []*remote.Repository {
+
+	t.Helper()
+
+	repos, err := r.ListRepos(context.Background(), opts).All()
+	if err != nil {
+		t.Fatalf("Could not list the repositories: %s", err)
+	}
+
+	return repos
+}
+
+// checkClone clones a repository and checks that it has a single commit, which adds a README.md
+func (s *suite) checkClone(t *testing.T, r remote.Remote, repo *remote.Repository) {
+
+	t.Helper()
+
+	tmp, err := ioutil.TempDir("", "gitrc-conformance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, repo.Name)
+	err = r.CloneRepo(context.Background(), repo.FullName, &remote.CloneOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("Could not clone %s: %s", repo.FullName, err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range files {
+		if f.Name() != ".git" {
+			names = append(names, f.Name())
+		}
+	}
+	if len(names) != 1 || names[0] != "README.md" {
+		t.Errorf("Clone of %s contains %s, want only README.md", repo.FullName, names)
+	}
+
+	clone, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := clone.Head()
+	if err != nil {
+		t.Fatalf("Clone of %s has no HEAD: %s", repo.FullName, err)
+	}
+	if repo.DefaultBranch != "" && head.Name().Short() != repo.DefaultBranch {
+		t.Errorf("Clone of %s checked out %s, want the default branch %s", repo.FullName, head.Name().Short(), repo.DefaultBranch)
+	}
+
+	commits, err := clone.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	commits.ForEach(func(*object.Commit) error {
+		n++
+		return nil
+	})
+	if n != 1 {
+		t.Errorf("Clone of %s has %d commits, want a single commit", repo.FullName, n)
+	}
+}
+
+// find returns the listed repositories with the given full name
+func find(repos []*remote.Repository, fullName string) []*remote.Repository {
+
+	found := []*remote.Repository{}
+	for _, repo := range repos {
+		if repo.FullName == fullName {
+			found = append(found, repo)
+		}
+	}
+
+	return found
+}
+
+// hasVisibility checks if v is one of visibilities
+func hasVisibility(visibilities []remote.Visibility, v remote.Visibility) bool {
+	for _, visibility := range visibilities {
+		if visibility == v {
+			return true
+		}
+	}
+	return false
+}
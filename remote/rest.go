@@ -0,0 +1,130 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// restClient is a minimal client for the json rest apis of providers without a go sdk
+type restClient struct {
+	baseURL    string
+	httpClient *http.Client
+
+	// authorize adds the credentials to a request
+	authorize func(req *http.Request)
+	// message extracts the error message from the body of a failed request, the whole body is used if nil
+	message func(body []byte) string
+	// prefix is removed from the body of responses before it is decoded
+	prefix string
+}
+
+// statusError is returned for responses, whose status is not 2xx
+type statusError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+// Error returns the status and the message of the response
+func (e *statusError) Error() string {
+	if e.Message == "" {
+		return e.Status
+	}
+	return fmt.Sprintf("%s: %s", e.Status, e.Message)
+}
+
+// isStatus checks if err is a statusError with the given status code
+func isStatus(err error, code int) bool {
+	e, ok := err.(*statusError)
+	return ok && e.StatusCode == code
+}
+
+// url returns the url of path, which may be relative to the base url or absolute
+func (c *restClient) url(path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return strings.TrimSuffix(c.baseURL, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// do sends a request with in as json body and decodes the json response into out, in and out may be nil
+func (c *restClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	return c.send(ctx, method, path, "application/json", body, out)
+}
+
+// send sends a request with a body of the given content type and decodes the json response into out
+func (c *restClient) send(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+
+	req, err := http.NewRequest(method, c.url(path), body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.authorize != nil {
+		c.authorize(req)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		msg := strings.TrimSpace(string(data))
+		if c.message != nil {
+			if m := c.message(data); m != "" {
+				msg = m
+			}
+		}
+		return &statusError{StatusCode: resp.StatusCode, Status: resp.Status, Message: msg}
+	}
+
+	data = bytes.TrimPrefix(data, []byte(c.prefix))
+	if out == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,372 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// sourcehutURL is the url of git.sr.ht
+const sourcehutURL = "https://git.sr.ht"
+
+func init() {
+	Register("sourcehut", func(p Provider) (Remote, error) { return NewSourcehutRemote(p) }, Capabilities{
+		Visibilities: Visibilities,
+		Protocols:    []string{"ssh", "http"},
+		ListOrder:    ListOrderName,
+	})
+}
+
+// SourcehutRemote implements Remote for git.sr.ht with its GraphQL api
+type SourcehutRemote struct {
+	Provider   Provider
+	HTTPClient *http.Client
+
+	// WebBaseURL is the url of the git.sr.ht instance
+	WebBaseURL *url.URL
+
+	rest *restClient
+	// push pushes the README of new repositories, git.sr.ht only accepts pushes via ssh
+	push func(ctx context.Context, url string, auth transport.AuthMethod, author, name string) error
+}
+
+// sourcehutRepo is a repository of the git.sr.ht api
+type sourcehutRepo struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Visibility string    `json:"visibility"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+	Owner      struct {
+		CanonicalName string `json:"canonicalName"`
+	} `json:"owner"`
+}
+
+// sourcehutRepoFields are the fields of a repository, which are queried
+const sourcehutRepoFields = "id name visibility created updated owner { canonicalName }"
+
+// graphql sends a query with variables to the api and decodes the data of the response into out
+func (s *SourcehutRemote) graphql(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+
+	result := struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	err := s.rest.do(ctx, "POST", "query", map[string]interface{}{"query": query, "variables": variables}, &result)
+	if err != nil {
+		return err
+	}
+
+	// GraphQL reports errors in the body of successful responses
+	if len(result.Errors) > 0 {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("%s", strings.Join(messages, ", "))
+	}
+
+	return json.Unmarshal(result.Data, out)
+}
+
+// getRepo fetches a repository given as "~owner/name" or "name", which is a repository of the token owner
+func (s *SourcehutRemote) getRepo(ctx context.Context, name string) (*sourcehutRepo, error) {
+
+	owner, name := splitName(name)
+
+	data := struct {
+		Repository *sourcehutRepo `json:"repository"`
+	}{}
+	var err error
+	if owner == "" {
+		err = s.graphql(ctx, "query($name: String!) { repository: repositoryByName(name: $name) { "+sourcehutRepoFields+" } }",
+			map[string]interface{}{"name": name}, &data)
+	} else {
+		err = s.graphql(ctx, "query($owner: String!, $name: String!) { repository: repositoryByOwner(owner: $owner, repo: $name) { "+sourcehutRepoFields+" } }",
+			map[string]interface{}{"owner": "~" + strings.TrimPrefix(owner, "~"), "name": name}, &data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data.Repository == nil {
+		return nil, fmt.Errorf("Repository %s not found", name)
+	}
+
+	return data.Repository, nil
+}
+
+// sourcehutVisibility maps a visibility to the visibility of git.sr.ht, where internal repositories are unlisted
+func sourcehutVisibility(visibility Visibility) string {
+	if visibility == VisibilityInternal {
+		return "UNLISTED"
+	}
+	return strings.ToUpper(string(visibility))
+}
+
+// CreateRepo creates a remote repository of the token owner.
+// git.sr.ht can't create files, so the basic README is pushed via ssh.
+func (s *SourcehutRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	visibility, err := opts.visibility(s.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if owner, _ := splitName(name); owner != "" {
+		return nil, fmt.Errorf("Repositories can only be created for the owner of the token")
+	}
+
+	data := struct {
+		Repository *sourcehutRepo `json:"createRepository"`
+	}{}
+	err = s.graphql(ctx, "mutation($name: String!, $visibility: Visibility!) { createRepository(name: $name, visibility: $visibility) { "+sourcehutRepoFields+" } }",
+		map[string]interface{}{"name": name, "visibility": sourcehutVisibility(visibility)}, &data)
+	if err != nil {
+		return nil, err
+	}
+	repo := s.repository(data.Repository)
+
+	// Create a basic README, a repository without it is deleted again
+	err = s.pushReadme(ctx, repo, name)
+	if err != nil {
+		s.delete(ctx, data.Repository.ID)
+		return nil, fmt.Errorf("Could not push the README to %s: %s", repo.FullName, err)
+	}
+
+	return repo, nil
+}
+
+// pushReadme pushes a basic README to the new repository via ssh
+func (s *SourcehutRemote) pushReadme(ctx context.Context, repo *Repository, name string) error {
+
+	endpoint, err := transport.NewEndpoint(repo.SSHURL)
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+	auth, err := sshAuth(s.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return s.push(ctx, repo.SSHURL, auth, s.Provider.User, name)
+}
+
+// CloneRepo clones the remote repository
+func (s *SourcehutRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	var endpoint *transport.Endpoint
+
+	repo, err := s.getRepo(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	urls := s.repository(repo)
+
+	// Define a git endpoint, git.sr.ht only accepts pushes via ssh
+	switch s.Provider.CloneProtocol {
+	case "ssh", "":
+		endpoint, err = transport.NewEndpoint(urls.SSHURL)
+	case "http":
+		endpoint, err = transport.NewEndpoint(urls.HTTPURL)
+	default:
+		err = fmt.Errorf("Unknown clone protocol %s", s.Provider.CloneProtocol)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := sshAuth(s.Provider, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository
+func (s *SourcehutRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	// Repositories are deleted by their id
+	repo, err := s.getRepo(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return s.delete(ctx, repo.ID)
+}
+
+// delete deletes the repository with the given id
+func (s *SourcehutRemote) delete(ctx context.Context, id int) error {
+
+	data := struct {
+		Repository *sourcehutRepo `json:"deleteRepository"`
+	}{}
+	err := s.graphql(ctx, "mutation($id: Int!) { deleteRepository(id: $id) { id } }", map[string]interface{}{"id": id}, &data)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetVisibility changes the visibility of a (remote) repository
+func (s *SourcehutRemote) SetVisibility(ctx context.Context, name string, visibility Visibility) error {
+
+	repo, err := s.getRepo(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		Repository *sourcehutRepo `json:"updateRepository"`
+	}{}
+	err = s.graphql(ctx, "mutation($id: Int!, $input: RepoInput!) { updateRepository(id: $id, input: $input) { id } }",
+		map[string]interface{}{"id": repo.ID, "input": map[string]string{"visibility": sourcehutVisibility(visibility)}}, &data)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos lists the repos of the token owner or of another user sorted by name.
+// The api pages with cursors, which are remembered for the page numbers of the iterator.
+func (s *SourcehutRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	owner := opts.owner()
+	if owner == "" {
+		owner = s.Provider.Owner
+	}
+
+	// Both queries return the repositories as owner
+	query := "query($cursor: Cursor) { owner: me { repositories(cursor: $cursor) { results { " + sourcehutRepoFields + " } cursor } } }"
+	if owner != "" {
+		query = "query($owner: String!, $cursor: Cursor) { owner: user(username: $owner) { repositories(cursor: $cursor) { results { " + sourcehutRepoFields + " } cursor } } }"
+	}
+
+	cursors := map[int]string{}
+
+	// The page size is fixed by the server, the api lists in no defined order
+	return NewRepoIterator(ctx, opts, 0, sortByName(0, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		variables := map[string]interface{}{}
+		if owner != "" {
+			variables["owner"] = strings.TrimPrefix(owner, "~")
+		}
+		if page > 1 {
+			variables["cursor"] = cursors[page]
+		}
+
+		data := struct {
+			Owner *struct {
+				Repositories struct {
+					Results []*sourcehutRepo `json:"results"`
+					Cursor  string           `json:"cursor"`
+				} `json:"repositories"`
+			} `json:"owner"`
+		}{}
+		err := s.graphql(ctx, query, variables, &data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if data.Owner == nil {
+			return nil, 0, fmt.Errorf("User %s not found", owner)
+		}
+
+		result := data.Owner.Repositories
+		repos := make([]*Repository, 0, len(result.Results))
+		for _, r := range result.Results {
+			repos = append(repos, s.repository(r))
+		}
+
+		// The last page has no cursor
+		if result.Cursor == "" {
+			return repos, 0, nil
+		}
+		cursors[page+1] = result.Cursor
+
+		return repos, page + 1, nil
+	}))
+}
+
+// repository converts a git.sr.ht repository into a Repository, the urls are derived from the web base url
+func (s *SourcehutRemote) repository(r *sourcehutRepo) *Repository {
+
+	visibility := Visibility(strings.ToLower(r.Visibility))
+	if r.Visibility == "UNLISTED" {
+		visibility = VisibilityInternal
+	}
+
+	fullName := r.Owner.CanonicalName + "/" + r.Name
+	web := fmt.Sprintf("%s://%s/%s", s.WebBaseURL.Scheme, s.WebBaseURL.Host, fullName)
+
+	return &Repository{
+		Name:       r.Name,
+		FullName:   fullName,
+		Visibility: visibility,
+		SSHURL:     fmt.Sprintf("git@%s:%s", s.WebBaseURL.Hostname(), fullName),
+		HTTPURL:    web,
+		WebURL:     web,
+		Created:    r.Created,
+		Updated:    r.Updated,
+	}
+}
+
+// NewSourcehutRemote creates a new Remote object and returns it.
+// Requests are authenticated with a personal access token.
+func NewSourcehutRemote(p Provider) (*SourcehutRemote, error) {
+
+	var err error
+
+	remote := new(SourcehutRemote)
+
+	if p.Type == "" {
+		p.Type = "sourcehut"
+	}
+	if p.HostBaseURL == "" {
+		p.HostBaseURL = sourcehutURL
+	}
+
+	remote.WebBaseURL, err = url.Parse(p.HostBaseURL)
+	if err != nil || remote.WebBaseURL.Host == "" {
+		return nil, fmt.Errorf("Invalid host base url %s", p.HostBaseURL)
+	}
+
+	remote.Provider = p
+	remote.HTTPClient = new(http.Client)
+	remote.rest = &restClient{
+		baseURL:    p.HostBaseURL,
+		httpClient: remote.HTTPClient,
+		authorize: func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+p.Token)
+		},
+	}
+	remote.push = pushReadme
+
+	return remote, nil
+}
@@ -0,0 +1,352 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// sourcehutToken is the token the stand-in accepts
+const sourcehutToken = "sourcehut-token"
+
+// sourcehutStandIn is a local stand-in of the GraphQL api of git.sr.ht for the queries used by SourcehutRemote.
+// The token belongs to alice, listings are paged by cursors of pageLen repositories.
+type sourcehutStandIn struct {
+	server  *httptest.Server
+	pageLen int
+
+	mu       sync.Mutex
+	repos    []*sourcehutRepo
+	nextID   int
+	cursors  []interface{}
+	pushes   []string
+	pushFail error
+}
+
+// newSourcehutStandIn starts a stand-in, which is closed at the end of the test
+func newSourcehutStandIn(t *testing.T) *sourcehutStandIn {
+
+	s := &sourcehutStandIn{pageLen: 2}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// remote returns a SourcehutRemote using the stand-in, which records pushes instead of pushing via ssh
+func (s *sourcehutStandIn) remote(t *testing.T) *SourcehutRemote {
+
+	r, err := NewSourcehutRemote(Provider{HostBaseURL: s.server.URL, Token: sourcehutToken, User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.push = func(ctx context.Context, url string, auth transport.AuthMethod, author, name string) error {
+		s.pushes = append(s.pushes, fmt.Sprintf("%s %s %s", url, author, name))
+		return s.pushFail
+	}
+
+	return r
+}
+
+// addRepo adds a repository of owner
+func (s *sourcehutStandIn) addRepo(owner, name, visibility string) *sourcehutRepo {
+
+	s.nextID++
+	repo := &sourcehutRepo{ID: s.nextID, Name: name, Visibility: visibility}
+	repo.Owner.CanonicalName = "~" + owner
+	s.repos = append(s.repos, repo)
+
+	return repo
+}
+
+// find returns the repository of owner with the given name
+func (s *sourcehutStandIn) find(owner, name string) *sourcehutRepo {
+	for _, repo := range s.repos {
+		if repo.Owner.CanonicalName == "~"+owner && repo.Name == name {
+			return repo
+		}
+	}
+	return nil
+}
+
+// serveHTTP answers a GraphQL request, errors of queries are reported in successful responses like git.sr.ht does
+func (s *sourcehutStandIn) serveHTTP(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+sourcehutToken {
+		http.Error(w, "Invalid authorization", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != "POST" || r.URL.Path != "/query" {
+		http.NotFound(w, r)
+		return
+	}
+
+	req := struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vars := req.Variables
+
+	var data interface{}
+	var err error
+	switch {
+	case strings.Contains(req.Query, "createRepository"):
+		data, err = s.create(vars["name"].(string), vars["visibility"].(string))
+	case strings.Contains(req.Query, "repositoryByName"):
+		data = map[string]interface{}{"repository": s.find("alice", vars["name"].(string))}
+	case strings.Contains(req.Query, "repositoryByOwner"):
+		data = map[string]interface{}{"repository": s.find(strings.TrimPrefix(vars["owner"].(string), "~"), vars["name"].(string))}
+	case strings.Contains(req.Query, "deleteRepository"):
+		data, err = s.delete(int(vars["id"].(float64)))
+	case strings.Contains(req.Query, "updateRepository"):
+		data, err = s.update(int(vars["id"].(float64)), vars["input"].(map[string]interface{}))
+	case strings.Contains(req.Query, "repositories(cursor: $cursor)"):
+		owner := "alice"
+		if o, ok := vars["owner"]; ok {
+			owner = o.(string)
+		}
+		s.cursors = append(s.cursors, vars["cursor"])
+		data, err = s.list(owner, vars["cursor"])
+	default:
+		err = fmt.Errorf("Unknown query %s", req.Query)
+	}
+
+	result := map[string]interface{}{"data": data}
+	if err != nil {
+		result = map[string]interface{}{"data": nil, "errors": []map[string]string{{"message": err.Error()}}}
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// create creates a repository of alice
+func (s *sourcehutStandIn) create(name, visibility string) (interface{}, error) {
+
+	if s.find("alice", name) != nil {
+		return nil, errors.New("A repository with this name already exists.")
+	}
+	switch visibility {
+	case "PUBLIC", "PRIVATE", "UNLISTED":
+	default:
+		return nil, fmt.Errorf("Invalid visibility %s", visibility)
+	}
+
+	return map[string]interface{}{"createRepository": s.addRepo("alice", name, visibility)}, nil
+}
+
+// delete deletes a repository by its id
+func (s *sourcehutStandIn) delete(id int) (interface{}, error) {
+
+	for i, repo := range s.repos {
+		if repo.ID == id {
+			s.repos = append(s.repos[:i], s.repos[i+1:]...)
+			return map[string]interface{}{"deleteRepository": repo}, nil
+		}
+	}
+
+	return nil, errors.New("No repository by ID exists")
+}
+
+// update changes the visibility of a repository
+func (s *sourcehutStandIn) update(id int, input map[string]interface{}) (interface{}, error) {
+
+	for _, repo := range s.repos {
+		if repo.ID == id {
+			repo.Visibility = input["visibility"].(string)
+			return map[string]interface{}{"updateRepository": repo}, nil
+		}
+	}
+
+	return nil, errors.New("No repository by ID exists")
+}
+
+// list returns the page of the repositories of owner at cursor, the cursor is the index of the first repository
+func (s *sourcehutStandIn) list(owner string, cursor interface{}) (interface{}, error) {
+
+	start := 0
+	if cursor != nil {
+		var err error
+		start, err = strconv.Atoi(cursor.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cursor %v", cursor)
+		}
+	}
+
+	if owner != "alice" && owner != "bob" {
+		return map[string]interface{}{"owner": nil}, nil
+	}
+	repos := []*sourcehutRepo{}
+	for _, repo := range s.repos {
+		if repo.Owner.CanonicalName == "~"+owner {
+			repos = append(repos, repo)
+		}
+	}
+
+	end := start + s.pageLen
+	var next interface{}
+	if end < len(repos) {
+		next = strconv.Itoa(end)
+	} else {
+		end = len(repos)
+	}
+	if start > end {
+		start = end
+	}
+
+	page := map[string]interface{}{"results": repos[start:end], "cursor": next}
+	return map[string]interface{}{"owner": map[string]interface{}{"repositories": page}}, nil
+}
+
+func TestSourcehutCreateRepo(t *testing.T) {
+
+	s := newSourcehutStandIn(t)
+	r := s.remote(t)
+	ctx := context.Background()
+	host := strings.TrimPrefix(s.server.URL, "http://")
+	host = host[:strings.Index(host, ":")]
+
+	repo, err := r.CreateRepo(ctx, "tool", &CreateOptions{Visibility: VisibilityInternal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "~alice/tool" || repo.Visibility != VisibilityInternal {
+		t.Errorf("Created %s with the visibility %s, want an internal ~alice/tool", repo.FullName, repo.Visibility)
+	}
+	if s.find("alice", "tool").Visibility != "UNLISTED" {
+		t.Errorf("Repository was created with the visibility %s, want UNLISTED", s.find("alice", "tool").Visibility)
+	}
+	if want := fmt.Sprintf("git@%s:~alice/tool alice tool", host); len(s.pushes) != 1 || s.pushes[0] != want {
+		t.Errorf("Pushed %v, want the README pushed as %s", s.pushes, want)
+	}
+
+	// Errors are reported in the body of a successful response
+	_, err = r.CreateRepo(ctx, "tool", nil)
+	if err == nil || err.Error() != "A repository with this name already exists." {
+		t.Errorf("Creating an existing repository returned %v, want the GraphQL error", err)
+	}
+	if _, err = r.CreateRepo(ctx, "~bob/tool", nil); err == nil {
+		t.Errorf("Creating a repository of another user succeeded")
+	}
+
+	s.pushFail = errors.New("push failed")
+	if _, err = r.CreateRepo(ctx, "other", nil); err == nil || !strings.Contains(err.Error(), "push failed") {
+		t.Errorf("Creating a repository with a failing push returned %v", err)
+	}
+	if s.find("alice", "other") != nil {
+		t.Errorf("Repository without a README was not deleted")
+	}
+}
+
+func TestSourcehutListRepos(t *testing.T) {
+
+	s := newSourcehutStandIn(t)
+	// The api lists in no defined order, the remote sorts by name
+	for i := 4; i >= 0; i-- {
+		s.addRepo("alice", fmt.Sprintf("repo-%d", i), "PUBLIC")
+	}
+	s.addRepo("bob", "other", "PUBLIC")
+	r := s.remote(t)
+	ctx := context.Background()
+
+	repos, err := r.ListRepos(ctx, nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 5 {
+		t.Fatalf("Listed %d repositories, want 5", len(repos))
+	}
+	for i, repo := range repos {
+		if want := fmt.Sprintf("~alice/repo-%d", i); repo.FullName != want {
+			t.Errorf("Repository %d is %s, want %s", i, repo.FullName, want)
+		}
+	}
+	if fmt.Sprint(s.cursors) != "[<nil> 2 4]" {
+		t.Errorf("Pages were requested with the cursors %v, want [<nil> 2 4]", s.cursors)
+	}
+
+	// The sorted listing is fetched completely, even with a limit
+	s.cursors = nil
+	repos, err = r.ListRepos(ctx, &ListOptions{Limit: 3}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 3 || repos[2].FullName != "~alice/repo-2" || len(s.cursors) != 3 {
+		t.Errorf("Listed %d repositories with %d pages, want repo-0 to repo-2 with 3 pages", len(repos), len(s.cursors))
+	}
+
+	repos, err = r.ListRepos(ctx, &ListOptions{Owner: "~bob"}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].FullName != "~bob/other" {
+		t.Errorf("Listed %v for ~bob, want ~bob/other", repos)
+	}
+
+	_, err = r.ListRepos(ctx, &ListOptions{Owner: "carol"}).All()
+	if err == nil || err.Error() != "User carol not found" {
+		t.Errorf("Listing an unknown user returned %v, want not found", err)
+	}
+}
+
+func TestSourcehutDeleteRepo(t *testing.T) {
+
+	s := newSourcehutStandIn(t)
+	s.addRepo("alice", "tool", "PRIVATE")
+	r := s.remote(t)
+	ctx := context.Background()
+
+	if err := r.DeleteRepo(ctx, "tool"); err != nil {
+		t.Fatal(err)
+	}
+	if s.find("alice", "tool") != nil {
+		t.Errorf("Repository was not deleted")
+	}
+	if err := r.DeleteRepo(ctx, "tool"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Deleting a missing repository returned %v, want not found", err)
+	}
+}
+
+func TestSourcehutSetVisibility(t *testing.T) {
+
+	s := newSourcehutStandIn(t)
+	s.addRepo("alice", "tool", "PRIVATE")
+	r := s.remote(t)
+
+	if err := r.SetVisibility(context.Background(), "tool", VisibilityPublic); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.find("alice", "tool").Visibility; v != "PUBLIC" {
+		t.Errorf("Repository has the visibility %s, want PUBLIC", v)
+	}
+}
@@ -0,0 +1,494 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// sshPerPage is the page size of the locally paged listing
+const sshPerPage = 100
+
+func init() {
+	Register("ssh", func(p Provider) (Remote, error) { return NewSSHRemote(p) }, Capabilities{
+		Visibilities: []Visibility{VisibilityPrivate},
+		Protocols:    []string{"ssh"},
+		ListOrder:    ListOrderName,
+	})
+}
+
+// SSHRemote implements Remote for bare repositories below a base path of a plain ssh server.
+// Repositories are managed with shell commands, the server needs git and a posix shell.
+type SSHRemote struct {
+	Provider Provider
+
+	// Host is the address of the ssh server as host:port
+	Host string
+	// User is the user to log in as
+	User string
+	// BasePath is the absolute path of the directory containing the repositories
+	BasePath string
+
+	// HostKeyCallback verifies the host key of the server, it defaults to the keys in ~/.ssh/known_hosts
+	HostKeyCallback ssh.HostKeyCallback
+
+	agentOnce sync.Once
+	agent     agent.Agent
+	agentErr  error
+}
+
+// sshRepo is a repository as listed by the list script
+type sshRepo struct {
+	path          string
+	updated       time.Time
+	defaultBranch string
+	size          int64
+}
+
+// sshListScript prints path, last commit, default branch and size of all bare repositories below the working directory,
+// the .git directories of worktrees are skipped
+const sshListScript = `find . -name .git -prune -o -type d -name '*.git' -print -prune | while read -r d; do
+	printf '%s\t%s\t%s\t%s\n' "$d" "$(git --git-dir="$d" log -1 --format=%ct 2>/dev/null)" "$(git --git-dir="$d" symbolic-ref --short HEAD 2>/dev/null)" "$(du -sk "$d" | cut -f1)"
+done`
+
+// shellQuote quotes s for a posix shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// path returns the path of the repository name on the server, which gets the .git suffix
+func (s *SSHRemote) path(name string) (string, error) {
+
+	name = strings.TrimSuffix(name, ".git")
+	err := checkName(name)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(s.BasePath, name) + ".git", nil
+}
+
+// url returns the ssh url of the repository path on the server
+func (s *SSHRemote) url(p string) string {
+	return (&url.URL{Scheme: "ssh", User: url.User(s.User), Host: s.Host, Path: p}).String()
+}
+
+// auth returns the ssh authentication methods, the key file is preferred over the ssh-agent
+func (s *SSHRemote) auth() ([]ssh.AuthMethod, error) {
+
+	var methods []ssh.AuthMethod
+
+	if s.Provider.SSHKeyFile != "" {
+		key, err := ioutil.ReadFile(s.Provider.SSHKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read ssh key %s: %s", s.Provider.SSHKeyFile, err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read ssh key %s: %s", s.Provider.SSHKeyFile, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	} else if os.Getenv("SSH_AUTH_SOCK") != "" {
+		// The agent stays connected, because go-git authenticates later on its own connection
+		s.agentOnce.Do(func() {
+			conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+			if err != nil {
+				s.agentErr = fmt.Errorf("Could not connect to the ssh-agent: %s", err)
+				return
+			}
+			s.agent = agent.NewClient(conn)
+		})
+		if s.agentErr != nil {
+			return nil, s.agentErr
+		}
+		methods = append(methods, ssh.PublicKeysCallback(s.agent.Signers))
+	}
+
+	if s.Provider.Password != "" {
+		methods = append(methods, ssh.Password(s.Provider.Password))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("No ssh_key_file, ssh-agent or password for %s", s.Host)
+	}
+
+	return methods, nil
+}
+
+// clientConfig returns the configuration of ssh connections to the server
+func (s *SSHRemote) clientConfig() (*ssh.ClientConfig, error) {
+
+	methods, err := s.auth()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            methods,
+		HostKeyCallback: s.HostKeyCallback,
+	}, nil
+}
+
+// sshClientAuth uses the client configuration of the remote for the ssh transport of go-git
+type sshClientAuth struct {
+	config *ssh.ClientConfig
+}
+
+// Name returns the name of the authentication method
+func (a *sshClientAuth) Name() string {
+	return "ssh-remote"
+}
+
+// String returns the user and the name of the authentication method
+func (a *sshClientAuth) String() string {
+	return fmt.Sprintf("user: %s, name: %s", a.config.User, a.Name())
+}
+
+// ClientConfig returns the client configuration of the remote
+func (a *sshClientAuth) ClientConfig() (*ssh.ClientConfig, error) {
+	return a.config, nil
+}
+
+// gitAuth returns the authentication of the remote for the ssh transport of go-git
+func (s *SSHRemote) gitAuth() (transport.AuthMethod, error) {
+
+	cfg, err := s.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sshClientAuth{config: cfg}, nil
+}
+
+// run runs the shell command cmd on the server and returns its output.
+// The connection is closed, when ctx is cancelled.
+func (s *SSHRemote) run(ctx context.Context, cmd string) (string, error) {
+
+	cfg, err := s.clientConfig()
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := new(net.Dialer).DialContext(ctx, "tcp", s.Host)
+	if err != nil {
+		return "", fmt.Errorf("Could not connect to %s: %s", s.Host, err)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, s.Host, cfg)
+	if err != nil {
+		conn.Close()
+		return "", fmt.Errorf("Could not connect to %s: %s", s.Host, err)
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("Could not open a session on %s: %s", s.Host, err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(cmd) }()
+
+	select {
+	case <-ctx.Done():
+		client.Close()
+		return "", ctx.Err()
+	case err = <-done:
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("Command failed on %s: %s", s.Host, msg)
+	}
+
+	return stdout.String(), nil
+}
+
+// CreateRepo creates a bare repository and pushes an initial commit of a basic README.
+// Repositories on the server are only accessible to its users, so they are always private.
+func (s *SSHRemote) CreateRepo(ctx context.Context, name string, opts *CreateOptions) (*Repository, error) {
+
+	visibility, err := opts.visibility(s.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if visibility != VisibilityPrivate {
+		return nil, unsupportedVisibility(s.Provider.Type, visibility)
+	}
+
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create repo, the default branch is set explicitly as it depends on the git version
+	q := shellQuote(p)
+	_, err = s.run(ctx, fmt.Sprintf("test ! -e %s || { echo 'Repository %s already exists' >&2; exit 1; } && git init --bare -q %s && git --git-dir=%s symbolic-ref HEAD refs/heads/master",
+		q, strings.Replace(name, "'", "", -1), q, q))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a basic README, a repository without it is removed again
+	auth, err := s.gitAuth()
+	if err == nil {
+		_, repoName := splitName(strings.TrimSuffix(name, ".git"))
+		err = pushReadme(ctx, s.url(p), auth, s.Provider.User, repoName)
+	}
+	if err != nil {
+		s.run(ctx, "rm -rf "+q)
+		return nil, fmt.Errorf("Could not push the README to %s: %s", name, err)
+	}
+
+	now := time.Now()
+	return s.repository(&sshRepo{path: p, updated: now, defaultBranch: "master"}, now), nil
+}
+
+// CloneRepo clones the remote repository
+func (s *SSHRemote) CloneRepo(ctx context.Context, name string, opts *CloneOptions) error {
+
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := transport.NewEndpoint(s.url(p))
+	if err != nil {
+		return fmt.Errorf("Error creating endpoint: %s", err)
+	}
+
+	auth, err := s.gitAuth()
+	if err != nil {
+		return err
+	}
+
+	return cloneEndpoint(ctx, endpoint, auth, name, opts)
+}
+
+// DeleteRepo deletes a (remote) repository, only bare repositories are removed
+func (s *SSHRemote) DeleteRepo(ctx context.Context, name string) error {
+
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	q := shellQuote(p)
+	_, err = s.run(ctx, fmt.Sprintf("test -f %s/HEAD && test -d %s/objects || { echo 'Repository %s not found' >&2; exit 1; } && rm -rf %s",
+		q, q, strings.Replace(name, "'", "", -1), q))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos lists the bare repositories below the base path or the directory of the owner.
+// All repositories are listed by a single command, the listing is paged locally.
+func (s *SSHRemote) ListRepos(ctx context.Context, opts *ListOptions) *RepoIterator {
+
+	owner := opts.owner()
+	if owner == "" {
+		owner = s.Provider.Owner
+	}
+
+	var all []*sshRepo
+
+	return NewRepoIterator(ctx, opts, sshPerPage, func(ctx context.Context, page, perPage int) ([]*Repository, int, error) {
+
+		if page == 1 {
+			root := s.BasePath
+			if owner != "" {
+				err := checkName(owner)
+				if err != nil {
+					return nil, 0, err
+				}
+				root = path.Join(root, owner)
+			}
+
+			// A missing directory has no repositories
+			out, err := s.run(ctx, fmt.Sprintf("test -d %[1]s || exit 0; cd %[1]s && %[2]s", shellQuote(root), sshListScript))
+			if err != nil {
+				return nil, 0, err
+			}
+			all = parseSSHRepos(root, out)
+		}
+
+		start := (page - 1) * perPage
+		end := start + perPage
+		if end >= len(all) {
+			end = len(all)
+		}
+		if start >= end {
+			return nil, 0, nil
+		}
+
+		repos := make([]*Repository, 0, end-start)
+		for _, r := range all[start:end] {
+			repos = append(repos, s.repository(r, time.Time{}))
+		}
+
+		next := page + 1
+		if end == len(all) {
+			next = 0
+		}
+
+		return repos, next, nil
+	})
+}
+
+// parseSSHRepos parses the output of the list script run in root, the repositories are sorted by name
+func parseSSHRepos(root, out string) []*sshRepo {
+
+	repos := []*sshRepo{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			continue
+		}
+
+		r := &sshRepo{path: path.Join(root, fields[0]), defaultBranch: fields[2]}
+		if ts, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			r.updated = time.Unix(ts, 0)
+		}
+		r.size, _ = strconv.ParseInt(fields[3], 10, 64)
+		repos = append(repos, r)
+	}
+
+	// The names have no .git suffix, so foo comes before foo-bar
+	sort.Slice(repos, func(i, j int) bool {
+		return strings.TrimSuffix(repos[i].path, ".git") < strings.TrimSuffix(repos[j].path, ".git")
+	})
+
+	return repos
+}
+
+// repository converts a listed repository into a Repository
+func (s *SSHRemote) repository(r *sshRepo, created time.Time) *Repository {
+
+	fullName := strings.TrimSuffix(strings.TrimPrefix(r.path, s.BasePath+"/"), ".git")
+	_, name := splitName(fullName)
+
+	return &Repository{
+		Name:          name,
+		FullName:      fullName,
+		Visibility:    VisibilityPrivate,
+		DefaultBranch: r.defaultBranch,
+		SSHURL:        s.url(r.path),
+		Created:       created,
+		Updated:       r.updated,
+		Size:          r.size,
+	}
+}
+
+// NewSSHRemote creates a new Remote object and returns it.
+// The host base url is an ssh url like ssh://git@example.com:22/srv/git, whose path is the base path of the repositories.
+// The user defaults to the configured user and the user of the local system.
+func NewSSHRemote(p Provider) (*SSHRemote, error) {
+
+	if p.Type == "" {
+		p.Type = "ssh"
+	}
+
+	user := p.User
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+
+	remote, err := newSSHRemote(p, user)
+	if err != nil {
+		return nil, err
+	}
+	if remote.BasePath == "/" || !path.IsAbs(remote.BasePath) {
+		return nil, fmt.Errorf("No absolute base path in host base url %s", p.HostBaseURL)
+	}
+
+	return remote, nil
+}
+
+// newSSHRemote creates the connection settings of an ssh remote from the host base url of p.
+// The user defaults to defaultUser, if the url contains none.
+func newSSHRemote(p Provider, defaultUser string) (*SSHRemote, error) {
+
+	if p.HostBaseURL == "" {
+		return nil, fmt.Errorf("No host_base_url configured for %s", p.Type)
+	}
+
+	remote := new(SSHRemote)
+
+	base := p.HostBaseURL
+	if !strings.Contains(base, "://") {
+		base = "ssh://" + base
+	}
+	u, err := url.Parse(base)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() == "" {
+		return nil, fmt.Errorf("Invalid host base url %s, it must be like ssh://user@host:port/path", p.HostBaseURL)
+	}
+
+	remote.Host = u.Host
+	if u.Port() == "" {
+		remote.Host = net.JoinHostPort(u.Hostname(), "22")
+	}
+	remote.BasePath = path.Clean(u.Path)
+
+	remote.User = u.User.Username()
+	if remote.User == "" {
+		remote.User = defaultUser
+	}
+
+	// Without known hosts every connection fails with the reason
+	knownHosts := filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+	remote.HostKeyCallback, err = knownhosts.New(knownHosts)
+	if err != nil {
+		knownHostsErr := fmt.Errorf("Could not read known hosts %s: %s", knownHosts, err)
+		remote.HostKeyCallback = func(hostname string, addr net.Addr, key ssh.PublicKey) error {
+			return knownHostsErr
+		}
+	}
+
+	remote.Provider = p
+
+	return remote, nil
+}
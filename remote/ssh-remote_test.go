@@ -0,0 +1,468 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v4"
+)
+
+// sshStandIn is an in-process ssh server, which runs the commands of alice with sh in its base path.
+// It serves the git transport by running git-upload-pack and git-receive-pack like an ordinary ssh server.
+type sshStandIn struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.PublicKey
+	base     string
+	keyFile  string
+
+	// rewrite optionally replaces the commands of the client, before they are run
+	rewrite func(cmd string) string
+
+	mu       sync.Mutex
+	commands []string
+}
+
+// newSSHKey generates an ecdsa key
+func newSSHKey(t *testing.T) *ecdsa.PrivateKey {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// newSSHStandIn starts an ssh server with a temporary base path, which is removed at the end of the test
+func newSSHStandIn(t *testing.T) *sshStandIn {
+
+	dir, err := ioutil.TempDir("", "gitrc-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	s := &sshStandIn{base: filepath.Join(dir, "srv"), keyFile: filepath.Join(dir, "id_ecdsa")}
+	err = os.Mkdir(s.base, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key of alice is written to a file for the provider
+	clientKey := newSSHKey(t)
+	der, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(s.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, err := ssh.NewPublicKey(&clientKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostSigner, err := ssh.NewSignerFromKey(newSSHKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.hostKey = hostSigner.PublicKey()
+
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() != "alice" || !bytes.Equal(key.Marshal(), clientPub.Marshal()) {
+				return nil, fmt.Errorf("Unknown key for %s", meta.User())
+			}
+			return nil, nil
+		},
+	}
+	s.config.AddHostKey(hostSigner)
+
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.listener.Close() })
+	go s.serve()
+
+	return s
+}
+
+// remote returns an SSHRemote of alice using the stand-in
+func (s *sshStandIn) remote(t *testing.T) *SSHRemote {
+
+	r, err := NewSSHRemote(Provider{HostBaseURL: "ssh://alice@" + s.listener.Addr().String() + s.base, User: "alice", SSHKeyFile: s.keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.HostKeyCallback = ssh.FixedHostKey(s.hostKey)
+
+	return r
+}
+
+// serve accepts connections until the listener is closed
+func (s *sshStandIn) serve() {
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers the session channels of a connection
+func (s *sshStandIn) serveConn(conn net.Conn) {
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "Only sessions are supported")
+			continue
+		}
+		ch, reqs, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(ch, reqs)
+	}
+}
+
+// serveSession runs the command of the exec request of a session
+func (s *sshStandIn) serveSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+
+	defer ch.Close()
+
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		exe := struct{ Command string }{}
+		if err := ssh.Unmarshal(req.Payload, &exe); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+
+		s.mu.Lock()
+		s.commands = append(s.commands, exe.Command)
+		s.mu.Unlock()
+
+		cmd := exe.Command
+		if s.rewrite != nil {
+			cmd = s.rewrite(cmd)
+		}
+		status := uint32(0)
+		if err := s.exec(ch, cmd); err != nil {
+			status = 1
+			if exit, ok := err.(*exec.ExitError); ok {
+				status = uint32(exit.ExitCode())
+			}
+		}
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// exec runs cmd with the streams of the channel.
+// Stdin is copied separately, Wait would otherwise wait for the client to close it.
+func (s *sshStandIn) exec(ch ssh.Channel, cmd string) error {
+
+	c := exec.Command("sh", "-c", cmd)
+	c.Dir = s.base
+	c.Stdout = ch
+	c.Stderr = ch.Stderr()
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	err = c.Start()
+	if err != nil {
+		return err
+	}
+	go func() {
+		io.Copy(stdin, ch)
+		stdin.Close()
+	}()
+
+	return c.Wait()
+}
+
+// ran returns the number of commands run so far
+func (s *sshStandIn) ran() int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.commands)
+}
+
+// bareHead returns the files of the HEAD commit of the bare repository name
+func (s *sshStandIn) bareHead(t *testing.T, name string) []string {
+
+	repo, err := git.PlainOpen(filepath.Join(s.base, name+".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{}
+	for _, e := range tree.Entries {
+		files = append(files, e.Name)
+	}
+
+	return files
+}
+
+func TestSSHCreateRepo(t *testing.T) {
+
+	s := newSSHStandIn(t)
+	r := s.remote(t)
+	ctx := context.Background()
+
+	repo, err := r.CreateRepo(ctx, "team/tool", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "team/tool" || repo.Name != "tool" || repo.DefaultBranch != "master" {
+		t.Errorf("Created %s named %s on %s, want team/tool on master", repo.FullName, repo.Name, repo.DefaultBranch)
+	}
+	if want := "ssh://alice@" + r.Host + s.base + "/team/tool.git"; repo.SSHURL != want {
+		t.Errorf("Repository has the ssh url %s, want %s", repo.SSHURL, want)
+	}
+
+	// The README was pushed over ssh
+	if files := s.bareHead(t, "team/tool"); len(files) != 1 || files[0] != "README.md" {
+		t.Errorf("Repository contains %v, want the README.md", files)
+	}
+
+	_, err = r.CreateRepo(ctx, "team/tool", nil)
+	if err == nil || !strings.Contains(err.Error(), "Repository team/tool already exists") {
+		t.Errorf("Creating an existing repository returned %v", err)
+	}
+	_, err = r.CreateRepo(ctx, "public", &CreateOptions{Visibility: VisibilityPublic})
+	if err == nil {
+		t.Errorf("Creating a public repository succeeded")
+	}
+	if _, err = os.Stat(filepath.Join(s.base, "public.git")); !os.IsNotExist(err) {
+		t.Errorf("Public repository was created")
+	}
+
+	// New repositories get a hook rejecting the push of the README, the repository is removed again
+	templates := filepath.Join(s.base, "templates")
+	if err = os.MkdirAll(filepath.Join(templates, "hooks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(templates, "hooks", "pre-receive"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GIT_TEMPLATE_DIR", templates)
+	defer os.Unsetenv("GIT_TEMPLATE_DIR")
+	_, err = r.CreateRepo(ctx, "rejected", nil)
+	if err == nil || !strings.Contains(err.Error(), "Could not push the README to rejected") {
+		t.Errorf("Creating a repository with a rejected push returned %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(s.base, "rejected.git")); !os.IsNotExist(err) {
+		t.Errorf("Repository without a README was not removed")
+	}
+}
+
+func TestSSHListRepos(t *testing.T) {
+
+	s := newSSHStandIn(t)
+	r := s.remote(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"app", "team/lib", "team/tool"} {
+		if _, err := r.CreateRepo(ctx, name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Worktrees and their .git directories are no bare repositories
+	if out, err := exec.Command("git", "init", "-q", filepath.Join(s.base, "work")).CombinedOutput(); err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+
+	repos, err := r.ListRepos(ctx, nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, repo := range repos {
+		names = append(names, repo.FullName)
+		if repo.DefaultBranch != "master" || repo.Updated.IsZero() || repo.Size == 0 || repo.Visibility != VisibilityPrivate {
+			t.Errorf("Listed %s with the default branch %q, last update %s, size %d and visibility %s",
+				repo.FullName, repo.DefaultBranch, repo.Updated, repo.Size, repo.Visibility)
+		}
+	}
+	if strings.Join(names, ",") != "app,team/lib,team/tool" {
+		t.Errorf("Listed %v, want app, team/lib and team/tool", names)
+	}
+
+	// The listing of an owner is limited to its directory, the listing is run once
+	before := s.ran()
+	repos, err = r.ListRepos(ctx, &ListOptions{Owner: "team", Limit: 1}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].FullName != "team/lib" {
+		t.Errorf("Listed %v for team with a limit of 1, want team/lib", repos)
+	}
+	if s.ran() != before+1 {
+		t.Errorf("Listing ran %d commands, want 1", s.ran()-before)
+	}
+
+	// An owner without a directory has no repositories, like the local remote
+	repos, err = r.ListRepos(ctx, &ListOptions{Owner: "nobody"}).All()
+	if err != nil || len(repos) != 0 {
+		t.Errorf("Listing a missing owner returned %v, %v, want an empty list", repos, err)
+	}
+}
+
+func TestSSHDeleteRepo(t *testing.T) {
+
+	s := newSSHStandIn(t)
+	r := s.remote(t)
+	ctx := context.Background()
+
+	if _, err := r.CreateRepo(ctx, "tool", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteRepo(ctx, "tool"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.base, "tool.git")); !os.IsNotExist(err) {
+		t.Errorf("Repository was not removed")
+	}
+
+	// Only bare repositories are removed
+	if err := os.MkdirAll(filepath.Join(s.base, "data.git", "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := r.DeleteRepo(ctx, "data")
+	if err == nil || !strings.Contains(err.Error(), "Repository data not found") {
+		t.Errorf("Deleting a directory returned %v, want not found", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.base, "data.git", "keep")); err != nil {
+		t.Errorf("Directory was removed: %s", err)
+	}
+}
+
+func TestSSHCloneRepo(t *testing.T) {
+
+	s := newSSHStandIn(t)
+	r := s.remote(t)
+	ctx := context.Background()
+
+	if _, err := r.CreateRepo(ctx, "team/tool", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "gitrc-clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = r.CloneRepo(ctx, "team/tool", &CloneOptions{Dir: filepath.Join(dir, "tool")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "tool", "README.md")); err != nil {
+		t.Errorf("Clone has no README.md: %s", err)
+	}
+}
+
+func TestSSHHostKey(t *testing.T) {
+
+	s := newSSHStandIn(t)
+	r := s.remote(t)
+
+	// A server with another host key is refused before any command is run
+	other, err := ssh.NewSignerFromKey(newSSHKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.HostKeyCallback = ssh.FixedHostKey(other.PublicKey())
+
+	_, err = r.CreateRepo(context.Background(), "tool", nil)
+	if err == nil {
+		t.Errorf("Creating a repository on a server with an unknown host key succeeded")
+	}
+	if s.ran() != 0 {
+		t.Errorf("Ran %d commands on a server with an unknown host key", s.ran())
+	}
+}
+
+func TestParseSSHRepos(t *testing.T) {
+
+	out := "./foo.git\t1600000000\tmaster\t12\n" +
+		"./foo-bar.git\t\tmain\t4\n" +
+		"./a/x.git\t1600000000\tmaster\t8\n" +
+		"./a-b.git\t1600000000\tmaster\t8\n" +
+		"incomplete line\n"
+
+	r := &SSHRemote{BasePath: "/srv/git"}
+	names := []string{}
+	for _, repo := range parseSSHRepos("/srv/git", out) {
+		names = append(names, r.repository(repo, time.Time{}).FullName)
+	}
+	if strings.Join(names, ",") != "a-b,a/x,foo,foo-bar" {
+		t.Errorf("Parsed %v, want a-b, a/x, foo, foo-bar", names)
+	}
+}
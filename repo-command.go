@@ -0,0 +1,503 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/wpueschel/gitrc/remote"
+)
+
+// newRemote reads the config file and creates the selected remote
+func newRemote(o *options) (remote.Remote, remote.Provider, error) {
+
+	config, err := remote.NewConfig(o.configFile)
+	if err != nil {
+		return nil, remote.Provider{}, fmt.Errorf("Could not read config: %s", err)
+	}
+
+	if o.provider == "" {
+		return nil, remote.Provider{}, fmt.Errorf("No remote given, use --provider where remote can be one of: %s", config.Names())
+	}
+
+	r, err := config.Remote(o.provider)
+	if err != nil {
+		return nil, remote.Provider{}, err
+	}
+
+	// The type may be derived from the name of the remote
+	p := config.Provider[o.provider]
+	p.Type, _ = config.Type(o.provider)
+
+	return r, p, nil
+}
+
+// newRepoCommand creates the repo command and its subcommands
+func newRepoCommand() *command {
+
+	c := &command{
+		name:  "repo",
+		short: "Manage remote repositories",
+	}
+
+	return c.add(
+		newRepoCreateCommand(),
+		newRepoCloneCommand(),
+		newRepoDeleteCommand(),
+		newRepoListCommand(),
+		newRepoVisibilityCommand(),
+		newRepoArchiveCommand(),
+		newRepoRenameCommand(),
+		newRepoForkCommand(),
+	)
+}
+
+// newRepoCreateCommand creates the repo create command
+func newRepoCreateCommand() *command {
+
+	var visibility, dir string
+	var clone bool
+
+	c := &command{
+		name:  "create",
+		usage: "create [flags] [name]",
+		short: "Create a remote repository",
+		long: `Creates a new remote repository with a basic README.md in it.
+The name may be prefixed with an owner, e.g. "org/name", to create the repository in an organisation.
+If no name is given, the name of the current directory is used and
+--clone clones the new repository into the current directory.`,
+	}
+
+	c.setFlags = func(fs *flag.FlagSet) {
+		fs.StringVar(&visibility, "visibility", "", fmt.Sprintf("Visibility of the repository, one of: %s (default: the visibility of the remote or private)", remote.Visibilities))
+		fs.StringVar(&visibility, "V", "", "Visibility of the repository (shorthand)")
+		fs.BoolVar(&clone, "clone", false, "Clone the repository after creation")
+		fs.StringVar(&dir, "dir", "", "Directory to clone into (default: the repository name)")
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 0, 1); err != nil {
+			return err
+		}
+
+		p, err := newPrinter(os.Stdout, c.opts)
+		if err != nil {
+			return err
+		}
+
+		r, _, err := newRemote(c.opts)
+		if err != nil {
+			return err
+		}
+
+		var name string
+		cloneOpts := &remote.CloneOptions{Progress: os.Stderr}
+		if len(args) == 1 {
+			name = args[0]
+		} else {
+			cloneOpts.Dir, err = os.Getwd()
+			if err != nil {
+				return err
+			}
+			name = filepath.Base(cloneOpts.Dir)
+		}
+		if dir != "" {
+			cloneOpts.Dir = dir
+		}
+		if !clone {
+			cloneOpts = nil
+		}
+
+		opts := new(remote.CreateOptions)
+		if visibility != "" {
+			opts.Visibility, err = remote.ParseVisibility(visibility)
+			if err != nil {
+				return err
+			}
+		}
+
+		return createRepo(ctx, r, name, opts, cloneOpts, p)
+	}
+
+	return c
+}
+
+// newRepoCloneCommand creates the repo clone command
+func newRepoCloneCommand() *command {
+
+	c := &command{
+		name:  "clone",
+		usage: "clone [flags] <name> [directory]",
+		short: "Clone a remote repository",
+		long: `Clones an existing remote repository.
+The name may be prefixed with an owner, e.g. "org/name".
+If no directory is given, the repository is cloned into a directory named like the repository.`,
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 1, 2); err != nil {
+			return err
+		}
+
+		r, _, err := newRemote(c.opts)
+		if err != nil {
+			return err
+		}
+
+		cloneOpts := &remote.CloneOptions{Progress: os.Stderr}
+		if len(args) == 2 {
+			cloneOpts.Dir = args[1]
+		}
+
+		err = r.CloneRepo(ctx, args[0], cloneOpts)
+		if err != nil {
+			return fmt.Errorf("Could not clone the remote repository %s: %s", args[0], err)
+		}
+
+		return nil
+	}
+
+	return c
+}
+
+// newRepoDeleteCommand creates the repo delete command
+func newRepoDeleteCommand() *command {
+
+	c := &command{
+		name:  "delete",
+		usage: "delete [flags] <name>",
+		short: "Delete a remote repository",
+		long: `Deletes a remote repository, the name may be prefixed with an owner, e.g. "org/name".
+Be careful, there is no second thought. It's just being deleted.`,
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 1, 1); err != nil {
+			return err
+		}
+
+		r, _, err := newRemote(c.opts)
+		if err != nil {
+			return err
+		}
+
+		return deleteRepo(ctx, r, args[0])
+	}
+
+	return c
+}
+
+// newRepoListCommand creates the repo list command
+func newRepoListCommand() *command {
+
+	var long bool
+	var limit int
+	var typ string
+	var subgroups bool
+
+	c := &command{
+		name:  "list",
+		usage: "list [flags] [owner]",
+		short: "List remote repositories",
+		long: `Lists all remote repositories in the list_order of the provider, either the most recently updated first
+or sorted by name, see "gitrc providers -o json".
+If an owner, e.g. an organisation or a GitLab group path, is given, its repositories are listed
+instead of those of the configured owner or user.`,
+	}
+
+	c.setFlags = func(fs *flag.FlagSet) {
+		fs.BoolVar(&long, "long", false, "Also list the clone URLs")
+		fs.BoolVar(&long, "l", false, "Also list the clone URLs (shorthand)")
+		fs.IntVar(&limit, "limit", 0, "Maximum number of repositories to list (default: all)")
+		fs.StringVar(&typ, "type", "", "Type of repositories to list, e.g. forks or member for GitHub organisations")
+		fs.BoolVar(&subgroups, "include-subgroups", false, "Also list the repositories of all subgroups of a GitLab group")
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 0, 1); err != nil {
+			return err
+		}
+
+		p, err := newPrinter(os.Stdout, c.opts)
+		if err != nil {
+			return err
+		}
+
+		r, provider, err := newRemote(c.opts)
+		if err != nil {
+			return err
+		}
+
+		// Types are silently ignored by providers, which can't filter by them
+		if caps, ok := remote.ProviderCapabilities(provider.Type); typ != "" && ok && len(caps.ListTypes) == 0 {
+			return fmt.Errorf("Remote %s can not filter repositories by type", c.opts.provider)
+		}
+
+		opts := &remote.ListOptions{Limit: limit, Type: typ, IncludeSubgroups: subgroups}
+		if len(args) == 1 {
+			opts.Owner = args[0]
+		}
+
+		return listRepos(ctx, r, p, opts, long, provider.CloneProtocol)
+	}
+
+	return c
+}
+
+// newRepoVisibilityCommand creates the repo visibility command
+func newRepoVisibilityCommand() *command {
+
+	c := &command{
+		name:  "visibility",
+		usage: "visibility [flags] <name> <public|internal|private>",
+		short: "Change the visibility of a remote repository",
+		long: `Changes the visibility of an existing remote repository.
+Not every provider supports every visibility, e.g. internal repositories only exist on GitLab and in GitHub organisations.`,
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 2, 2); err != nil {
+			return err
+		}
+
+		visibility, err := remote.ParseVisibility(args[1])
+		if err != nil {
+			return err
+		}
+
+		r, _, err := newRemote(c.opts)
+		if err != nil {
+			return err
+		}
+
+		setter, ok := r.(remote.VisibilitySetter)
+		if !ok {
+			return fmt.Errorf("Remote %s can not change the visibility of repositories", c.opts.provider)
+		}
+
+		err = setter.SetVisibility(ctx, args[0], visibility)
+		if err != nil {
+			return fmt.Errorf("Could not change the visibility of repository %s: %s", args[0], err)
+		}
+
+		return nil
+	}
+
+	return c
+}
+
+// newRepoArchiveCommand creates the repo archive command
+func newRepoArchiveCommand() *command {
+
+	var undo bool
+
+	c := &command{
+		name:  "archive",
+		usage: "archive [flags] <name>",
+		short: "Archive a remote repository",
+		long: `Archives an existing remote repository, which makes it read-only.
+With --undo the repository is unarchived again.`,
+	}
+
+	c.setFlags = func(fs *flag.FlagSet) {
+		fs.BoolVar(&undo, "undo", false, "Unarchive the repository")
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 1, 1); err != nil {
+			return err
+		}
+
+		r, _, err := newRemote(c.opts)
+		if err != nil {
+			return err
+		}
+
+		archiver, ok := r.(remote.Archiver)
+		if !ok {
+			return fmt.Errorf("Remote %s can not archive repositories", c.opts.provider)
+		}
+
+		err = archiver.ArchiveRepo(ctx, args[0], !undo)
+		if err != nil {
+			return fmt.Errorf("Could not archive repository %s: %s", args[0], err)
+		}
+
+		return nil
+	}
+
+	return c
+}
+
+// newRepoRenameCommand creates the repo rename command
+func newRepoRenameCommand() *command {
+
+	c := &command{
+		name:  "rename",
+		usage: "rename [flags] <name> <new-name>",
+		short: "Rename a remote repository",
+		long: `Renames an existing remote repository.
+The repository keeps its owner, so the new name must not be prefixed with an owner.`,
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 2, 2); err != nil {
+			return err
+		}
+
+		r, _, err := newRemote(c.opts)
+		if err != nil {
+			return err
+		}
+
+		renamer, ok := r.(remote.Renamer)
+		if !ok {
+			return fmt.Errorf("Remote %s can not rename repositories", c.opts.provider)
+		}
+
+		err = renamer.RenameRepo(ctx, args[0], args[1])
+		if err != nil {
+			return fmt.Errorf("Could not rename repository %s: %s", args[0], err)
+		}
+
+		return nil
+	}
+
+	return c
+}
+
+// newRepoForkCommand creates the repo fork command
+func newRepoForkCommand() *command {
+
+	c := &command{
+		name:  "fork",
+		usage: "fork [flags] <name> [owner]",
+		short: "Fork a remote repository",
+		long: `Forks an existing remote repository to the user or, if an owner is given, into an organisation or GitLab group.
+The name may be prefixed with an owner, e.g. "org/name", to fork a repository of another owner.`,
+	}
+
+	c.run = func(ctx context.Context, args []string) error {
+
+		if err := c.exactArgs(args, 1, 2); err != nil {
+			return err
+		}
+
+		p, err := newPrinter(os.Stdout, c.opts)
+		if err != nil {
+			return err
+		}
+
+		r, _, err := newRemote(c.opts)
+		if err != nil {
+			return err
+		}
+
+		forker, ok := r.(remote.Forker)
+		if !ok {
+			return fmt.Errorf("Remote %s can not fork repositories", c.opts.provider)
+		}
+
+		owner := ""
+		if len(args) == 2 {
+			owner = args[1]
+		}
+
+		repo, err := forker.ForkRepo(ctx, args[0], owner)
+		if err != nil {
+			return fmt.Errorf("Could not fork repository %s: %s", args[0], err)
+		}
+
+		return p.print(repo, "full_name", "created_at", "web_url")
+	}
+
+	return c
+}
+
+// createRepo creates the repository name and clones it, if cloneOpts are given
+func createRepo(ctx context.Context, r remote.Remote, name string, opts *remote.CreateOptions, cloneOpts *remote.CloneOptions, p *printer) error {
+
+	repo, err := r.CreateRepo(ctx, name, opts)
+	if err != nil {
+		return fmt.Errorf("Could not create repository %s: %s", name, err)
+	}
+
+	err = p.print(repo, "name", "created_at", "web_url")
+	if err != nil {
+		return err
+	}
+
+	if cloneOpts != nil {
+		err = r.CloneRepo(ctx, name, cloneOpts)
+		if err != nil {
+			return fmt.Errorf("Could not clone the remote repository %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteRepo deletes the repository name
+func deleteRepo(ctx context.Context, r remote.Remote, name string) error {
+
+	err := r.DeleteRepo(ctx, name)
+	if err != nil {
+		return fmt.Errorf("Could not delete repository %s: %s", name, err)
+	}
+
+	return nil
+}
+
+// listRepos lists the remote repositories. Repositories are printed while they are fetched.
+// With long set, the table output contains the clone URL for the given protocol.
+func listRepos(ctx context.Context, r remote.Remote, p *printer, opts *remote.ListOptions, long bool, protocol string) error {
+
+	it := r.ListRepos(ctx, opts)
+	next := func() (interface{}, error) {
+		repo, err := it.Next()
+		if err == remote.Done {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not list repos: %s", err)
+		}
+		return repo, nil
+	}
+
+	columns := []string{"updated_at", "name"}
+	if long {
+		if protocol == "http" {
+			columns = append(columns, "http_url")
+		} else {
+			columns = append(columns, "ssh_url")
+		}
+	}
+
+	return p.printList(reflect.TypeOf(remote.Repository{}), next, columns...)
+}
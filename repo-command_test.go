@@ -0,0 +1,185 @@
+/*
+	Copyright 2018 Wilhelm Peter Püschel
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	    http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wpueschel/gitrc/remote"
+	"github.com/wpueschel/gitrc/remote/fakeforge"
+)
+
+// runRepo runs the repo command with args against the remote forge of the config file cfg and returns its output
+func runRepo(t *testing.T, cfg string, args ...string) (string, error) {
+
+	t.Helper()
+
+	out, err := ioutil.TempFile("", "gitrc-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = stdout }()
+
+	root := newRootCommand(context.Background())
+	err = root.execute(append([]string{"-c", cfg, "-p", "forge", "repo"}, args...))
+
+	data, readErr := ioutil.ReadFile(out.Name())
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+
+	return string(data), err
+}
+
+// newForgeConfig starts a fake forge of alice and writes a config file with it as remote forge
+func newForgeConfig(t *testing.T, flavour string) (*fakeforge.Server, string) {
+
+	s := fakeforge.New(flavour, "alice")
+	t.Cleanup(s.Close)
+
+	return s, writeConfig(t, map[string]remote.Provider{"forge": s.Provider()})
+}
+
+func TestRepoCommands(t *testing.T) {
+
+	for _, flavour := range []string{fakeforge.GitHub, fakeforge.GitLab, fakeforge.Gitea} {
+		t.Run(flavour, func(t *testing.T) {
+
+			s, cfg := newForgeConfig(t, flavour)
+
+			out, err := runRepo(t, cfg, "create", "-V", "private", "-o", "template", "--template", "{{.FullName}} {{.Visibility}}", "tool")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(out) != "alice/tool private" {
+				t.Errorf("Create printed %q, want alice/tool private", out)
+			}
+			if repo, ok := s.Repo("alice/tool"); !ok || repo.Visibility != remote.VisibilityPrivate {
+				t.Errorf("Forge has no private alice/tool")
+			}
+
+			out, err = runRepo(t, cfg, "list", "-o", "template", "--template", "{{.FullName}}")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(out) != "alice/tool" {
+				t.Errorf("List printed %q, want alice/tool", out)
+			}
+
+			// Clone over smart http
+			dir, err := ioutil.TempDir("", "gitrc-clone")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			_, err = runRepo(t, cfg, "clone", "alice/tool", filepath.Join(dir, "tool"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = os.Stat(filepath.Join(dir, "tool", "README.md")); err != nil {
+				t.Errorf("Clone has no README.md: %s", err)
+			}
+
+			_, err = runRepo(t, cfg, "delete", "alice/tool")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := s.Repo("alice/tool"); ok {
+				t.Errorf("Repository was not deleted")
+			}
+			_, err = runRepo(t, cfg, "delete", "alice/tool")
+			if err == nil || !strings.Contains(err.Error(), "Could not delete repository alice/tool") {
+				t.Errorf("Deleting a missing repository returned %v", err)
+			}
+		})
+	}
+}
+
+func TestRepoListPages(t *testing.T) {
+
+	for _, flavour := range []string{fakeforge.GitHub, fakeforge.GitLab, fakeforge.Gitea} {
+		t.Run(flavour, func(t *testing.T) {
+
+			s, cfg := newForgeConfig(t, flavour)
+			for i := 0; i < 120; i++ {
+				s.AddRepo(fmt.Sprintf("alice/repo-%03d", i), remote.VisibilityPublic)
+			}
+
+			out, err := runRepo(t, cfg, "list", "-o", "template", "--template", "{{.FullName}}")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Fields(out); len(lines) != 120 {
+				t.Errorf("List printed %d repositories, want 120", len(lines))
+			}
+
+			out, err = runRepo(t, cfg, "list", "--limit", "7", "-o", "template", "--template", "{{.FullName}}")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Fields(out); len(lines) != 7 {
+				t.Errorf("List with a limit of 7 printed %d repositories", len(lines))
+			}
+		})
+	}
+}
+
+func TestRepoErrors(t *testing.T) {
+
+	s, cfg := newForgeConfig(t, fakeforge.GitHub)
+
+	s.Fail("POST", "/api/v3/user/repos", http.StatusInternalServerError)
+	_, err := runRepo(t, cfg, "create", "tool")
+	if err == nil || !strings.Contains(err.Error(), "Could not create repository tool") {
+		t.Errorf("Create with a failing server returned %v", err)
+	}
+	if _, ok := s.Repo("alice/tool"); ok {
+		t.Errorf("Repository was created by a failed request")
+	}
+
+	s.SetRateLimit(0)
+	_, err = runRepo(t, cfg, "list")
+	if err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Errorf("List beyond the rate limit returned %v, want a rate limit error", err)
+	}
+}
+
+func TestRepoListType(t *testing.T) {
+
+	_, cfg := newForgeConfig(t, fakeforge.Gitea)
+	_, err := runRepo(t, cfg, "list", "--type", "forks")
+	if err == nil || !strings.Contains(err.Error(), "can not filter repositories by type") {
+		t.Errorf("Listing gitea repositories by type returned %v, want an error", err)
+	}
+
+	_, cfg = newForgeConfig(t, fakeforge.GitHub)
+	if _, err = runRepo(t, cfg, "list", "--type", "owner"); err != nil {
+		t.Errorf("Listing github repositories by type failed: %s", err)
+	}
+}